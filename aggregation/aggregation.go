@@ -3,21 +3,26 @@ package aggregation
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	backends "github.com/stellar/go/ingest/ledgerbackend"
 	"github.com/stellar/go/support/log"
 	"github.com/stellar/go/xdr"
 
 	"github.com/decentrio/soro-book/config"
 	db "github.com/decentrio/soro-book/database/handlers"
-	"github.com/decentrio/soro-book/database/models"
 	"github.com/decentrio/soro-book/lib/service"
 )
 
 const (
-	QueueSize          = 256
-	DefaultPrepareStep = 32
+	DefaultQueueSize          = 256
+	DefaultPrepareStep        = 32
+	DefaultDecodeWorkers      = 4
+	DefaultFetchRetryInterval = time.Second
+	DefaultShutdownTimeout    = 30 * time.Second
 )
 
 type Aggregation struct {
@@ -26,15 +31,24 @@ type Aggregation struct {
 	ACfg *config.AggregationConfig
 
 	ctx     context.Context
+	cancel  context.CancelFunc
 	Cfg     backends.CaptiveCoreConfig
 	backend backends.LedgerBackend
+	// archive keeps a copy of every raw ledger when enabled
+	archive *LedgerArchive
+	// filter limits the contract records that are persisted
+	filter *ContractFilter
 
-	// txQueue channel for trigger new tx
-	ledgerQueue              chan xdr.LedgerCloseMeta
-	txQueue                  chan TransactionWrapper
-	assetContractEventsQueue chan models.StellarAssetContractEvent
-	wasmContractEventsQueue  chan models.WasmContractEvent
-	contractDataEntrysQueue  chan models.ContractsData
+	// ledgerQueue feeds the decode workers in sequence order, bundleQueue
+	// feeds the committer in any order
+	ledgerQueue chan xdr.LedgerCloseMeta
+	bundleQueue chan *LedgerBundle
+	// inFlight bounds the ledgers fetched but not committed yet. It is sized
+	// by the same queueSize as ledgerQueue, so a ledger holding a slot always
+	// finds room in ledgerQueue and only inFlight blocks the fetcher.
+	inFlight chan struct{}
+	// nextCommitSeq is the next ledger the committer writes
+	nextCommitSeq uint32
 
 	// isSync is flag represent if services is
 	// re-synchronize
@@ -42,78 +56,275 @@ type Aggregation struct {
 	prepareStep uint32
 
 	StartLedgerSeq uint32
-	CurrLedgerSeq  uint32
+	// CurrLedgerSeq is the last known tip of the network
+	CurrLedgerSeq uint32
+	// EndLedgerSeq is the last ledger of a bounded run, 0 when following the tip
+	EndLedgerSeq uint32
+
+	// pending counts the ledgers that are queued but not committed yet
+	pending    sync.WaitGroup
+	finishOnce sync.Once
+	fetchDone  chan struct{}
+	done       chan struct{}
+	errMtx     sync.Mutex
+	err        error
+	// fetchStopped is closed when the fetcher returns, quit stops the
+	// decode workers and the committer once the queues are drained
+	fetchStopped chan struct{}
+	quit         chan struct{}
+	// committed is the last ledger written to the database
+	committed atomic.Uint32
+	// write writes consecutive ledgers in one database transaction
+	write func(bundles []*LedgerBundle, batchSize int) error
+
+	ledgers      atomic.Uint64
+	transactions atomic.Uint64
+	events       atomic.Uint64
 
 	db *db.DBHandler
 }
 
+// Stats counts the records written by an aggregation
+type Stats struct {
+	Ledgers      uint64
+	Transactions uint64
+	Events       uint64
+}
+
 // AggregationOption sets an optional parameter on the State.
 type AggregationOption func(*Aggregation)
 
+// WithDBHandler makes the aggregation write to h instead of POSTGRES_URL.
+func WithDBHandler(h *db.DBHandler) AggregationOption {
+	return func(as *Aggregation) {
+		as.db = h
+	}
+}
+
 func NewAggregation(
 	cfg *config.AggregationConfig,
 	options ...AggregationOption,
 ) *Aggregation {
+	queueSize := int(cfg.QueueSize)
+	if queueSize == 0 {
+		queueSize = DefaultQueueSize
+	}
+
 	as := &Aggregation{
-		ledgerQueue:              make(chan xdr.LedgerCloseMeta, QueueSize),
-		txQueue:                  make(chan TransactionWrapper, QueueSize),
-		assetContractEventsQueue: make(chan models.StellarAssetContractEvent, QueueSize),
-		wasmContractEventsQueue:  make(chan models.WasmContractEvent, QueueSize),
-		contractDataEntrysQueue:  make(chan models.ContractsData, QueueSize),
-		prepareStep:              DefaultPrepareStep,
-		isSync:                   false,
-		ACfg:                     cfg,
+		ledgerQueue:  make(chan xdr.LedgerCloseMeta, queueSize),
+		bundleQueue:  make(chan *LedgerBundle, queueSize),
+		inFlight:     make(chan struct{}, queueSize),
+		prepareStep:  DefaultPrepareStep,
+		isSync:       false,
+		fetchDone:    make(chan struct{}),
+		done:         make(chan struct{}),
+		fetchStopped: make(chan struct{}),
+		quit:         make(chan struct{}),
+		ACfg:         cfg,
 	}
 
 	as.BaseService = *service.NewBaseService("Aggregation", as)
+	as.write = as.writeLedgers
 	for _, opt := range options {
 		opt(as)
 	}
 
-	logger := log.New().WithField("module", "aggregation")
+	logger := newLogger(as.ACfg.Network)
 	logger.SetLevel(log.DebugLevel)
 	as.BaseService.SetLogger(logger)
 
 	as.StartLedgerSeq = as.ACfg.StartLedgerHeight
-	as.CurrLedgerSeq = as.ACfg.CurrLedgerHeight
+	as.EndLedgerSeq = as.ACfg.EndLedgerHeight
 
-	fmt.Println(as.StartLedgerSeq, as.CurrLedgerSeq)
+	as.Logger.Debugf("ledger range [%d, %d]", as.StartLedgerSeq, as.EndLedgerSeq)
+
+	if as.db == nil {
+		as.db = db.NewDBHandler()
+	}
+	as.filter = NewContractFilter(as.ACfg.Filter)
 
-	as.db = db.NewDBHandler()
+	// live ingestion resumes after the last committed ledger
+	if as.EndLedgerSeq == 0 && !as.ACfg.StartExplicit {
+		cursor, found, err := as.db.GetCursor(as.cursorName())
+		if err != nil {
+			as.Logger.Fatalf("Error get cursor: %s", err.Error())
+		}
+		if found {
+			as.Logger.Infof("resume after cursor %d", cursor)
+			as.StartLedgerSeq = cursor + 1
+		}
+	}
 
-	as.ctx = context.Background()
+	// cancelling the context interrupts a fetch on stop
+	as.ctx, as.cancel = context.WithCancel(context.Background())
 	as.backend, as.Cfg = newLedgerBackend(as.ctx, *as.ACfg, as.Logger)
+
+	// no need to archive ledgers that are replayed from the archive
+	if as.ACfg.ArchiveDir != "" && as.ACfg.BackendType != ArchiveBackend {
+		archive, err := NewLedgerArchive(as.ACfg.ArchiveDir)
+		if err != nil {
+			as.Logger.Fatalf("Invalid archive dir: %s", err.Error())
+		}
+		as.archive = archive
+	}
+
 	return as
 }
 
 func (as *Aggregation) OnStart() error {
 	as.Logger.Info("Start")
-	go as.ledgerProcessing()
-	go as.transactionProcessing()
-	go as.contractDataEntryProcessing()
-	go as.contractEventsProcessing()
-	// Note that when using goroutines, you need to be careful to ensure that no
-	// race conditions occur when accessing the txQueue.
+	if as.ACfg.Bootstrap {
+		if err := as.bootstrap(); err != nil {
+			// nothing was fetched, stopping has nothing to wait for
+			close(as.fetchStopped)
+			return err
+		}
+	}
+
+	// ledgers are fetched in order, decoded in parallel and committed in order
+	as.nextCommitSeq = as.StartLedgerSeq
+	decodeWorkers := int(as.ACfg.DecodeWorkers)
+	if decodeWorkers == 0 {
+		decodeWorkers = DefaultDecodeWorkers
+	}
+	for i := 0; i < decodeWorkers; i++ {
+		go as.ledgerProcessing()
+	}
+	go as.commitProcessing()
 	go as.aggregation()
 	return nil
 }
 
+// OnStop stops fetching, then waits up to the shutdown timeout for the
+// fetched ledgers to be decoded and committed before stopping the workers.
 func (as *Aggregation) OnStop() error {
 	as.Logger.Info("Stop")
+	as.cancel()
+	<-as.fetchStopped
+
+	timeout := time.Duration(as.ACfg.ShutdownTimeout) * time.Second
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	drained := make(chan struct{})
+	go func() {
+		as.pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		as.Logger.Infof("queues drained, last committed ledger %d", as.committed.Load())
+	case <-time.After(timeout):
+		as.Logger.Errorf("queues not drained after %s, last committed ledger %d", timeout, as.committed.Load())
+	}
+
+	close(as.quit)
 	as.backend.Close()
 
 	return nil
 }
 
+// aggregation fetches ledgers until the service stops, a bounded run is
+// fully fetched or ingestion halts. Fetching blocks while the queues are
+// full, failures are retried with an exponential backoff and halt ingestion
+// at the ledger that could not be fetched once the retry timeout elapses.
 func (as *Aggregation) aggregation() {
+	defer close(as.fetchStopped)
+	retry := as.newBackOff()
 	for {
 		select {
 		// Terminate process
 		case <-as.BaseService.Terminate():
 			return
+		// Bounded range fully fetched or ingestion halted
+		case <-as.fetchDone:
+			return
 		default:
-			as.getNewLedger()
 		}
-		time.Sleep(time.Millisecond)
+
+		progress, err := as.getNewLedger()
+		wait := DefaultFetchRetryInterval
+		if err != nil {
+			// interrupted by stop
+			if as.ctx.Err() != nil {
+				return
+			}
+			wait = retry.NextBackOff()
+			if wait == backoff.Stop {
+				as.halt(as.StartLedgerSeq, fmt.Errorf("%w of %s exceeded: %w", ErrRetryTimeout, retry.MaxElapsedTime, err))
+				return
+			}
+			as.Logger.Error(fmt.Sprintf("%s, retry in %s", err.Error(), wait))
+		} else {
+			retry.Reset()
+			if progress {
+				continue
+			}
+		}
+
+		select {
+		case <-as.BaseService.Terminate():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// LastCommittedLedger returns the last ledger written to the database, 0
+// if none was written yet.
+func (as *Aggregation) LastCommittedLedger() uint32 {
+	return as.committed.Load()
+}
+
+// cursorName is the name of the cursor of the live ingestion
+func (as *Aggregation) cursorName() string {
+	return CursorName(as.ACfg)
+}
+
+// CursorName is the name of the cursor of the live ingestion of cfg
+func CursorName(cfg *config.AggregationConfig) string {
+	if cfg.Cursor != "" {
+		return cfg.Cursor
+	}
+	return cfg.Network
+}
+
+// finish stops fetching and closes Done once every queued record is handled.
+// The first error reported is kept.
+func (as *Aggregation) finish(err error) {
+	as.errMtx.Lock()
+	if as.err == nil {
+		as.err = err
+	}
+	as.errMtx.Unlock()
+
+	as.finishOnce.Do(func() {
+		close(as.fetchDone)
+		go func() {
+			as.pending.Wait()
+			close(as.done)
+		}()
+	})
+}
+
+// Done is closed when a bounded run has written its whole range or when
+// ingestion halts.
+func (as *Aggregation) Done() <-chan struct{} {
+	return as.done
+}
+
+// Err returns the error that ended a bounded run or halted ingestion, if any.
+func (as *Aggregation) Err() error {
+	as.errMtx.Lock()
+	defer as.errMtx.Unlock()
+	return as.err
+}
+
+// Stats returns the number of records written so far.
+func (as *Aggregation) Stats() Stats {
+	return Stats{
+		Ledgers:      as.ledgers.Load(),
+		Transactions: as.transactions.Load(),
+		Events:       as.events.Load(),
 	}
 }
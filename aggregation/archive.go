@@ -0,0 +1,85 @@
+package aggregation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stellar/go/xdr"
+)
+
+// ArchiveSchema is the layout of the raw ledger archive: one ledger per
+// file, partitioned by ledger range like the ledger exporter does.
+var ArchiveSchema = FileSchema{
+	LedgersPerFile:    1,
+	FilesPerPartition: DefaultFilesPerPartition,
+}
+
+// LedgerArchive writes raw LedgerCloseMeta as compressed XDR into a local
+// directory. The archive can be replayed with the archive backend.
+type LedgerArchive struct {
+	dir    string
+	schema FileSchema
+}
+
+func NewLedgerArchive(dir string) (*LedgerArchive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LedgerArchive{
+		dir:    dir,
+		schema: ArchiveSchema,
+	}, nil
+}
+
+// Write stores the ledger, replacing a previous copy of it. The file is
+// renamed into place once complete, so readers never see partial files.
+func (a *LedgerArchive) Write(lcm xdr.LedgerCloseMeta) error {
+	seq := lcm.LedgerSequence()
+	batch := xdr.LedgerCloseMetaBatch{
+		StartSequence:    xdr.Uint32(seq),
+		EndSequence:      xdr.Uint32(seq),
+		LedgerCloseMetas: []xdr.LedgerCloseMeta{lcm},
+	}
+	bz, err := batch.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(a.dir, a.schema.ObjectKey(seq))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".ledger-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	encoder, err := zstd.NewWriter(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := encoder.Write(bz); err != nil {
+		encoder.Close()
+		f.Close()
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("error archive ledger %d: %w", seq, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package aggregation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+
+	db "github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+const (
+	// EntryTypeCheckpoint is the entry type of contract data entries seeded
+	// from a history archive checkpoint
+	EntryTypeCheckpoint = db.EntryTypeCheckpoint
+
+	BootstrapBatchSize = 1000
+)
+
+// BootstrapStats counts the records seeded by Bootstrap
+type BootstrapStats struct {
+	Checkpoint    uint32
+	ContractsData uint64
+	ContractsCode uint64
+	Ttls          uint64
+}
+
+// CheckpointAtOrBefore returns the last checkpoint ledger that is not after ledger.
+func CheckpointAtOrBefore(ledger, checkpointFrequency uint32) (uint32, error) {
+	if ledger+1 < checkpointFrequency {
+		return 0, fmt.Errorf("no checkpoint at or before ledger %d", ledger)
+	}
+
+	return (ledger+1)/checkpointFrequency*checkpointFrequency - 1, nil
+}
+
+// Bootstrap seeds contracts_data, contracts_codes and contracts_ttls with
+// the contract state of the network at checkpoint, read from the history
+// archives. Contract data entries are stored at the checkpoint ledger with
+// the checkpoint entry type, and contracts are stored from their instances.
+// Everything is written in a single database transaction.
+func Bootstrap(
+	ctx context.Context,
+	h *db.DBHandler,
+	archive historyarchive.ArchiveInterface,
+	checkpoint uint32,
+	filter *ContractFilter,
+) (BootstrapStats, error) {
+	stats := BootstrapStats{Checkpoint: checkpoint}
+
+	if err := h.Migrate(&models.ContractsTtl{}); err != nil {
+		return stats, err
+	}
+
+	reader, err := ingest.NewCheckpointChangeReader(ctx, archive, checkpoint)
+	if err != nil {
+		return stats, fmt.Errorf("error read checkpoint %d: %w", checkpoint, err)
+	}
+	defer reader.Close()
+
+	err = h.Transaction(func(h *db.DBHandler) error {
+		var (
+			data  []models.ContractsData
+			codes []models.ContractsCode
+			ttls  []models.ContractsTtl
+			// key hashes of the entries that passed the filter
+			keep = map[string]struct{}{}
+		)
+
+		flush := func(force bool) error {
+			if force || len(data) >= BootstrapBatchSize {
+				if err := h.CreateContractsDataBatch(data); err != nil {
+					return err
+				}
+				stats.ContractsData += uint64(len(data))
+				data = data[:0]
+			}
+			if force || len(codes) >= BootstrapBatchSize {
+				if err := h.CreateContractsCodeBatch(codes); err != nil {
+					return err
+				}
+				stats.ContractsCode += uint64(len(codes))
+				codes = codes[:0]
+			}
+			if force || len(ttls) >= BootstrapBatchSize {
+				if err := h.CreateContractsTtlBatch(ttls); err != nil {
+					return err
+				}
+				stats.Ttls += uint64(len(ttls))
+				ttls = ttls[:0]
+			}
+			return nil
+		}
+
+		for {
+			change, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("error read checkpoint %d: %w", checkpoint, err)
+			}
+			if change.Post == nil {
+				continue
+			}
+
+			switch change.Type {
+			case xdr.LedgerEntryTypeContractData:
+				entry, err := checkpointContractData(*change.Post, checkpoint)
+				if err != nil {
+					return err
+				}
+				// the account of a checkpoint entry is not the one that wrote it
+				if !filter.Allow(entry.ContractId) {
+					continue
+				}
+				data = append(data, entry)
+
+				keyHash, err := ledgerEntryKeyHash(*change.Post)
+				if err != nil {
+					return err
+				}
+				keep[keyHash] = struct{}{}
+
+				code, found := checkpointContractCode(*change.Post, entry.ContractId)
+				if found {
+					codes = append(codes, code)
+					if wasmKeyHash, found := contractCodeKeyHash(*change.Post); found {
+						keep[wasmKeyHash] = struct{}{}
+					}
+				}
+
+			case xdr.LedgerEntryTypeTtl:
+				ttl := change.Post.Data.MustTtl()
+				ttls = append(ttls, models.ContractsTtl{
+					KeyHash:         ttl.KeyHash.HexString(),
+					LiveUntilLedger: uint32(ttl.LiveUntilLedgerSeq),
+					Ledger:          checkpoint,
+				})
+
+			default:
+				continue
+			}
+
+			if err := flush(false); err != nil {
+				return err
+			}
+		}
+
+		if err := flush(true); err != nil {
+			return err
+		}
+
+		// TTLs are read before their entries are known, drop the ones of
+		// filtered entries once all entries are read
+		if !filter.active() {
+			return nil
+		}
+		keyHashes := make([]string, 0, len(keep))
+		for keyHash := range keep {
+			keyHashes = append(keyHashes, keyHash)
+		}
+		return h.PruneContractsTtl(checkpoint, keyHashes, BootstrapBatchSize)
+	})
+
+	return stats, err
+}
+
+// bootstrap seeds the contract state at the checkpoint at or before the
+// start ledger and moves the start right after that checkpoint, so the
+// ledgers in between are ingested too.
+func (as *Aggregation) bootstrap() error {
+	if as.StartLedgerSeq == 0 {
+		return fmt.Errorf("bootstrap needs a start ledger")
+	}
+
+	bootstrapped, err := as.db.HasContractDataOfType(EntryTypeCheckpoint)
+	if err != nil {
+		return err
+	}
+	if bootstrapped {
+		as.Logger.Info("contract state already bootstrapped, skip")
+		return nil
+	}
+
+	checkpoint, err := CheckpointAtOrBefore(as.StartLedgerSeq, as.Cfg.CheckpointFrequency)
+	if err != nil {
+		return err
+	}
+
+	archive, err := newHistoryArchive(as.ctx, as.Cfg.NetworkPassphrase, as.Cfg.HistoryArchiveURLs, as.Cfg.CheckpointFrequency)
+	if err != nil {
+		return err
+	}
+
+	as.Logger.Infof("bootstrap contract state from checkpoint %d", checkpoint)
+	stats, err := Bootstrap(as.ctx, as.db, archive, checkpoint, as.filter)
+	if err != nil {
+		return fmt.Errorf("error bootstrap from checkpoint %d: %w", checkpoint, err)
+	}
+	as.Logger.Infof("bootstrapped %d contract data entries, %d contracts and %d ttls",
+		stats.ContractsData, stats.ContractsCode, stats.Ttls)
+
+	as.StartLedgerSeq = checkpoint + 1
+	return nil
+}
+
+func checkpointContractData(entry xdr.LedgerEntry, checkpoint uint32) (models.ContractsData, error) {
+	data := entry.Data.MustContractData()
+
+	keyBz, err := data.Key.MarshalBinary()
+	if err != nil {
+		return models.ContractsData{}, err
+	}
+	valBz, err := data.Val.MarshalBinary()
+	if err != nil {
+		return models.ContractsData{}, err
+	}
+
+	var contractId, accountId string
+	if data.Contract.ContractId != nil {
+		contractId, err = strkey.Encode(strkey.VersionByteContract, data.Contract.ContractId[:])
+		if err != nil {
+			return models.ContractsData{}, err
+		}
+	}
+	if data.Contract.AccountId != nil {
+		accountId, err = data.Contract.AccountId.GetAddress()
+		if err != nil {
+			return models.ContractsData{}, err
+		}
+	}
+
+	return models.ContractsData{
+		Id:            ContractDataId(checkpoint, "", contractId, accountId, keyBz),
+		ContractId:    contractId,
+		AccountId:     accountId,
+		Ledger:        checkpoint,
+		EntryType:     EntryTypeCheckpoint,
+		KeyXdr:        keyBz,
+		ValueXdr:      valBz,
+		Durability:    int32(data.Durability),
+		IsNewest:      true,
+		UpdatedLedger: uint32(math.MaxInt32),
+	}, nil
+}
+
+// checkpointContractCode returns the contract of a contract instance entry.
+func checkpointContractCode(entry xdr.LedgerEntry, contractId string) (models.ContractsCode, bool) {
+	data := entry.Data.MustContractData()
+	if data.Key.Type != xdr.ScValTypeScvLedgerKeyContractInstance {
+		return models.ContractsCode{}, false
+	}
+	instance, ok := data.Val.GetInstance()
+	if !ok {
+		return models.ContractsCode{}, false
+	}
+
+	var contractCode string
+	if instance.Executable.WasmHash != nil {
+		contractCode = instance.Executable.WasmHash.HexString()
+	}
+
+	return models.ContractsCode{
+		ContractId:    contractId,
+		ContractCode:  contractCode,
+		CreatedLedger: uint32(entry.LastModifiedLedgerSeq),
+	}, true
+}
+
+// contractCodeKeyHash returns the ledger key hash of the wasm of a contract
+// instance entry.
+func contractCodeKeyHash(entry xdr.LedgerEntry) (string, bool) {
+	instance, ok := entry.Data.MustContractData().Val.GetInstance()
+	if !ok || instance.Executable.WasmHash == nil {
+		return "", false
+	}
+
+	key := xdr.LedgerKey{
+		Type:         xdr.LedgerEntryTypeContractCode,
+		ContractCode: &xdr.LedgerKeyContractCode{Hash: *instance.Executable.WasmHash},
+	}
+	keyHash, err := ledgerKeyHash(key)
+	if err != nil {
+		return "", false
+	}
+
+	return keyHash, true
+}
+
+func ledgerEntryKeyHash(entry xdr.LedgerEntry) (string, error) {
+	key, err := entry.LedgerKey()
+	if err != nil {
+		return "", err
+	}
+
+	return ledgerKeyHash(key)
+}
+
+// ledgerKeyHash is the hash TTL entries refer to their entry by
+func ledgerKeyHash(key xdr.LedgerKey) (string, error) {
+	bz, err := key.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(bz)
+
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,20 @@
+package aggregation_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+)
+
+func TestCheckpointAtOrBefore(t *testing.T) {
+	_, err := aggregation.CheckpointAtOrBefore(62, 64)
+	require.Error(t, err)
+
+	for ledger, checkpoint := range map[uint32]uint32{63: 63, 64: 63, 127: 127, 50000000: 49999999} {
+		got, err := aggregation.CheckpointAtOrBefore(ledger, 64)
+		require.NoError(t, err)
+		require.Equal(t, checkpoint, got)
+	}
+}
@@ -0,0 +1,343 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	db "github.com/decentrio/soro-book/database/handlers"
+)
+
+const (
+	DefaultFlushSize     = 5000
+	DefaultFlushInterval = time.Second
+)
+
+// commitProcessing writes the decoded ledgers in strict sequence order.
+// Ledgers decoded ahead of the next one to commit wait in a reorder buffer,
+// ledgers ready to commit are buffered until flush size rows are pending or
+// the flush interval elapses. Once terminated it writes ledgers as soon as
+// they are ready, until the queues are drained. After a ledger fails to
+// commit ingestion halts and the ledgers after it are dropped.
+func (as *Aggregation) commitProcessing() {
+	flushSize := int(as.ACfg.FlushSize)
+	if flushSize == 0 {
+		flushSize = DefaultFlushSize
+	}
+	flushInterval := time.Duration(as.ACfg.FlushInterval) * time.Millisecond
+	if flushInterval == 0 {
+		flushInterval = DefaultFlushInterval
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	terminate := as.BaseService.Terminate()
+	draining := false
+	halted := false
+
+	// hash of the ledger before the next one to commit, ledgers must chain
+	var prevHash string
+	if !as.ACfg.SkipVerify {
+		var err error
+		prevHash, err = storedLedgerHash(as.db, as.nextCommitSeq-1)
+		if err != nil {
+			as.Logger.Error(fmt.Sprintf("Error get ledger %d: %s", as.nextCommitSeq-1, err.Error()))
+		}
+	}
+
+	waiting := make(map[uint32]*LedgerBundle)
+	var (
+		ready []*LedgerBundle
+		rows  int
+	)
+	flush := func() {
+		if seq, err := as.commitLedgers(ready, flushSize); err != nil {
+			as.halt(seq, err)
+			halted = true
+			// ledgers decoded ahead are dropped, they are fetched again
+			// after restart
+			for seq := range waiting {
+				delete(waiting, seq)
+				as.pending.Done()
+				<-as.inFlight
+			}
+		}
+		for range ready {
+			as.pending.Done()
+		}
+		ready = nil
+		rows = 0
+	}
+
+	for {
+		select {
+		case b := <-as.bundleQueue:
+			if halted {
+				as.pending.Done()
+				<-as.inFlight
+				continue
+			}
+			waiting[b.Ledger.Seq] = b
+			for {
+				next, found := waiting[as.nextCommitSeq]
+				if !found {
+					break
+				}
+				delete(waiting, as.nextCommitSeq)
+
+				if !as.ACfg.SkipVerify && next.err == nil {
+					if prevHash != "" {
+						if err := verifyChain(next.Ledger, prevHash); err != nil {
+							next.err = &VerifyError{Ledger: next.Ledger.Seq, Err: err}
+						}
+					}
+					prevHash = next.Ledger.Hash
+				}
+
+				// a ledger releases its inFlight slot on entry to ready, and
+				// its pending count once flushed, so buffered ledgers no
+				// longer hold back the fetcher
+				ready = append(ready, next)
+				rows += next.rows()
+				as.nextCommitSeq++
+				<-as.inFlight
+			}
+			if rows >= flushSize || (draining && len(ready) > 0) {
+				flush()
+			}
+		case <-ticker.C:
+			if len(ready) > 0 {
+				flush()
+			}
+		// Terminate process, keep committing what is already fetched
+		case <-terminate:
+			terminate = nil
+			draining = true
+			if len(ready) > 0 {
+				flush()
+			}
+		case <-as.quit:
+			if len(ready) > 0 {
+				flush()
+			}
+			return
+		}
+	}
+}
+
+// commitLedgers writes ledgers in one database transaction, transient
+// errors are retried with an exponential backoff. When a record is rejected
+// each ledger is written in its own transaction, so a ledger is either
+// fully indexed or not at all. It returns the first ledger that is not
+// committed and why, ledgers are never skipped.
+func (as *Aggregation) commitLedgers(bundles []*LedgerBundle, batchSize int) (uint32, error) {
+	// the ledgers before one that failed to decode are still committed
+	decoded := bundles
+	var failed *LedgerBundle
+	for i, b := range bundles {
+		if b.err != nil {
+			decoded, failed = bundles[:i], b
+			break
+		}
+	}
+
+	if len(decoded) > 0 {
+		if seq, err := as.commitDecoded(decoded, batchSize); err != nil {
+			return seq, err
+		}
+	}
+	if failed != nil {
+		return failed.Ledger.Seq, failed.err
+	}
+
+	return 0, nil
+}
+
+func (as *Aggregation) commitDecoded(bundles []*LedgerBundle, batchSize int) (uint32, error) {
+	if len(bundles) == 1 {
+		return bundles[0].Ledger.Seq, as.commitLedger(bundles[0], batchSize)
+	}
+
+	op := fmt.Sprintf("commit ledgers [%d, %d]", bundles[0].Ledger.Seq, bundles[len(bundles)-1].Ledger.Seq)
+	err := as.retry(as.quit, op, func() error {
+		return as.write(bundles, batchSize)
+	})
+	if err == nil {
+		return 0, nil
+	}
+	// retrying one by one does not help while the database is unavailable
+	if errors.Is(err, ErrRetryTimeout) {
+		return bundles[0].Ledger.Seq, err
+	}
+
+	as.Logger.Error(fmt.Sprintf("Error %s, retry one by one: %s", op, err.Error()))
+	for _, b := range bundles {
+		if err := as.commitLedger(b, batchSize); err != nil {
+			return b.Ledger.Seq, err
+		}
+	}
+
+	return 0, nil
+}
+
+// commitLedger writes a ledger in one database transaction. When a record
+// is rejected the records are written one transaction at a time instead and
+// the rejected ones go to the dead letters, so the rest of the ledger is
+// still committed.
+func (as *Aggregation) commitLedger(b *LedgerBundle, batchSize int) error {
+	op := fmt.Sprintf("commit ledger %d", b.Ledger.Seq)
+	err := as.retry(as.quit, op, func() error {
+		return as.write([]*LedgerBundle{b}, batchSize)
+	})
+	if err == nil {
+		return nil
+	}
+
+	var decodeErr *DecodeError
+	if errors.Is(err, ErrRetryTimeout) || errors.As(err, &decodeErr) {
+		return err
+	}
+	as.Logger.Error(fmt.Sprintf("Error %s, write records one by one: %s", op, err.Error()))
+	return as.retry(as.quit, op, func() error {
+		return as.writeLedgerWithDeadLetters(b)
+	})
+}
+
+// writeLedgers writes consecutive ledgers and their records in a single
+// database transaction. Errors that fail the same way every time are
+// returned as backoff.Permanent.
+func (as *Aggregation) writeLedgers(bundles []*LedgerBundle, batchSize int) error {
+	var batch db.Batch
+	for _, b := range bundles {
+		batch.Ledgers = append(batch.Ledgers, b.Ledger)
+		for _, tb := range b.Transactions {
+			if err := tb.addTo(&batch); err != nil {
+				return backoff.Permanent(&DecodeError{Ledger: b.Ledger.Seq, TxHash: tb.Transaction.Hash, Err: err})
+			}
+		}
+	}
+
+	err := as.db.Transaction(func(h *db.DBHandler) error {
+		if err := h.WriteBatch(&batch, batchSize); err != nil {
+			return err
+		}
+
+		// bounded runs such as backfill chunks leave the live cursor alone
+		if as.EndLedgerSeq == 0 {
+			return h.UpdateCursor(as.cursorName(), bundles[len(bundles)-1].Ledger.Seq)
+		}
+		return nil
+	})
+	if err != nil && !db.IsRetryable(err) {
+		return backoff.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	as.committedLedgers(bundles)
+	return nil
+}
+
+// committedLedgers moves the last committed ledger and the stats forward.
+func (as *Aggregation) committedLedgers(bundles []*LedgerBundle) {
+	var transactions, events uint64
+	for _, b := range bundles {
+		for _, tb := range b.Transactions {
+			events += uint64(len(tb.AssetEvents) + len(tb.WasmEvents))
+		}
+		transactions += uint64(len(b.Transactions))
+	}
+
+	as.committed.Store(bundles[len(bundles)-1].Ledger.Seq)
+	as.ledgers.Add(uint64(len(bundles)))
+	as.transactions.Add(transactions)
+	as.events.Add(events)
+}
+
+// rows is the number of rows a ledger writes
+func (b *LedgerBundle) rows() int {
+	rows := 1
+	for _, tb := range b.Transactions {
+		rows += 1 + len(tb.InvokeTransactions) + len(tb.CreatedContracts) + len(tb.ContractsData) +
+			len(tb.AssetEvents) + len(tb.WasmEvents)
+	}
+	return rows
+}
+
+// addTo buffers the rows of a transaction in batch.
+func (b TransactionBundle) addTo(batch *db.Batch) error {
+	batch.Transactions = append(batch.Transactions, *b.Transaction)
+	batch.InvokeTransactions = append(batch.InvokeTransactions, b.InvokeTransactions...)
+	batch.ContractsCodes = append(batch.ContractsCodes, b.CreatedContracts...)
+	batch.ContractsData = append(batch.ContractsData, b.ContractsData...)
+	batch.WasmEvents = append(batch.WasmEvents, b.WasmEvents...)
+	for _, event := range b.AssetEvents {
+		if err := batch.AddAssetContractEvent(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTransactionRecords writes the records derived from a transaction:
+// invocations, created contracts, contract data entries and events.
+func writeTransactionRecords(h *db.DBHandler, b TransactionBundle) error {
+	for _, recordType := range derivedRecordTypes {
+		if err := writeRecords(h, b, recordType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeRecords writes the records of a transaction stored in the table
+// recordType.
+func writeRecords(h *db.DBHandler, b TransactionBundle, recordType string) error {
+	switch recordType {
+	case RecordTransactions:
+		if _, err := h.CreateTransaction(b.Transaction); err != nil {
+			return fmt.Errorf("error create transaction %w", err)
+		}
+	case RecordInvokeTransactions:
+		for _, ivhft := range b.InvokeTransactions {
+			if _, err := h.CreateContractInvokedTransaction(&ivhft); err != nil {
+				return fmt.Errorf("error create invoke host function %w", err)
+			}
+		}
+	case RecordCreatedContracts:
+		for _, cct := range b.CreatedContracts {
+			if _, err := h.CreateContractCreatedTransaction(&cct); err != nil {
+				return fmt.Errorf("error create contract created function %w", err)
+			}
+		}
+	case RecordContractsData:
+		// contract data entries of the same key must be written in order for
+		// the is_newest bookkeeping
+		for _, e := range b.ContractsData {
+			if _, err := h.CreateContractEntry(&e); err != nil {
+				return fmt.Errorf("error create contract data entry %w", err)
+			}
+		}
+	case RecordAssetEvents:
+		for _, event := range b.AssetEvents {
+			if err := createAssetContractEvent(h, event); err != nil {
+				return fmt.Errorf("error create asset contract %s event %w", event.GetType(), err)
+			}
+		}
+	case RecordWasmEvents:
+		for _, event := range b.WasmEvents {
+			if _, err := h.CreateWasmContractEvent(&event); err != nil {
+				return fmt.Errorf("error create wasm contract event %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown record type %s", recordType)
+	}
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package aggregation_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/config"
+	db "github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// testWriter records the ledgers written by a test committer
+type testWriter struct {
+	mu      sync.Mutex
+	written []uint32
+}
+
+func (w *testWriter) write(bundles []*aggregation.LedgerBundle) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, b := range bundles {
+		w.written = append(w.written, b.Ledger.Seq)
+	}
+	return nil
+}
+
+func (w *testWriter) ledgers() []uint32 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]uint32(nil), w.written...)
+}
+
+func TestCommitInOrder(t *testing.T) {
+	w := &testWriter{}
+	as := aggregation.NewTestCommitter(&config.AggregationConfig{
+		SkipVerify:    true,
+		FlushSize:     2,
+		FlushInterval: 10,
+	}, nil, 10, w.write)
+	require.NoError(t, as.Start())
+
+	// decoding finished out of order
+	for _, seq := range []uint32{13, 11, 14, 10, 12, 16, 15} {
+		as.Decoded(models.Ledger{Seq: seq}, nil)
+	}
+
+	require.Eventually(t, func() bool {
+		return as.LastCommittedLedger() == 16
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, []uint32{10, 11, 12, 13, 14, 15, 16}, w.ledgers())
+	require.Equal(t, uint64(7), as.Stats().Ledgers)
+
+	require.NoError(t, as.Stop())
+}
+
+func TestCommitHalt(t *testing.T) {
+	w := &testWriter{}
+	as := aggregation.NewTestCommitter(&config.AggregationConfig{
+		SkipVerify:    true,
+		FlushInterval: 10,
+	}, nil, 10, w.write)
+	require.NoError(t, as.Start())
+
+	errDecode := errors.New("invalid ledger")
+	as.Decoded(models.Ledger{Seq: 12}, nil)
+	as.Decoded(models.Ledger{Seq: 11}, errDecode)
+	as.Decoded(models.Ledger{Seq: 10}, nil)
+
+	select {
+	case <-as.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ingestion did not halt")
+	}
+
+	// the ledgers before the failed one are committed, the ones after it dropped
+	var haltErr *aggregation.HaltError
+	require.ErrorAs(t, as.Err(), &haltErr)
+	require.Equal(t, uint32(11), haltErr.Ledger)
+	require.ErrorIs(t, as.Err(), errDecode)
+	require.Equal(t, []uint32{10}, w.ledgers())
+	require.Equal(t, uint32(10), as.LastCommittedLedger())
+
+	// ledgers decoded after the halt are dropped too
+	as.Decoded(models.Ledger{Seq: 13}, nil)
+	require.NoError(t, as.Stop())
+	require.Equal(t, []uint32{10}, w.ledgers())
+}
+
+func TestCommitHaltReleasesWaiting(t *testing.T) {
+	w := &testWriter{}
+	as := aggregation.NewTestCommitter(&config.AggregationConfig{
+		SkipVerify:    true,
+		QueueSize:     3,
+		FlushSize:     2,
+		FlushInterval: 60_000,
+	}, nil, 10, w.write)
+	require.NoError(t, as.Start())
+
+	// 13 waits for 12, which never comes, when flushing 10 and 11 halts
+	as.Decoded(models.Ledger{Seq: 13}, nil)
+	as.Decoded(models.Ledger{Seq: 10}, nil)
+	as.Decoded(models.Ledger{Seq: 11}, errors.New("invalid ledger"))
+
+	select {
+	case <-as.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ingestion did not halt")
+	}
+	var haltErr *aggregation.HaltError
+	require.ErrorAs(t, as.Err(), &haltErr)
+	require.Equal(t, uint32(11), haltErr.Ledger)
+	require.Equal(t, []uint32{10}, w.ledgers())
+
+	// the dropped ledger no longer holds back the fetcher
+	require.Zero(t, as.InFlight())
+
+	require.NoError(t, as.Stop())
+}
+
+func TestCommitDrainOnStop(t *testing.T) {
+	w := &testWriter{}
+	// nothing is flushed before stopping
+	as := aggregation.NewTestCommitter(&config.AggregationConfig{
+		SkipVerify:    true,
+		FlushInterval: 60_000,
+	}, nil, 10, w.write)
+	require.NoError(t, as.Start())
+
+	for _, seq := range []uint32{11, 10, 12} {
+		as.Decoded(models.Ledger{Seq: seq}, nil)
+	}
+	require.Empty(t, w.ledgers())
+
+	require.NoError(t, as.Stop())
+	require.Equal(t, []uint32{10, 11, 12}, w.ledgers())
+	require.Equal(t, uint32(12), as.LastCommittedLedger())
+}
+
+// TestCommitMovesCursor checks that the cursor moves with the ledger it
+// points to and stays on the last committed ledger when a commit fails.
+func TestCommitMovesCursor(t *testing.T) {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	h := db.NewDBHandler()
+
+	err := h.Transaction(func(h *db.DBHandler) error {
+		base := uint32(testLedgerBase)
+		cfg := &config.AggregationConfig{
+			Network:       "cursor-test",
+			SkipVerify:    true,
+			FlushInterval: 10,
+			RetryTimeout:  1,
+		}
+		as := aggregation.NewTestCommitter(cfg, h, base+1, nil)
+		require.NoError(t, as.Start())
+
+		as.Decoded(models.Ledger{Seq: base + 1, Hash: fmt.Sprintf("%064x", base+1)}, nil)
+		require.Eventually(t, func() bool {
+			return as.LastCommittedLedger() == base+1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		cursor, found, err := h.GetCursor("cursor-test")
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, base+1, cursor)
+
+		// postgres rejects a NUL byte in text
+		as.Decoded(models.Ledger{Seq: base + 2, Hash: "\x00"}, nil)
+		select {
+		case <-as.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("ingestion did not halt")
+		}
+		var haltErr *aggregation.HaltError
+		require.ErrorAs(t, as.Err(), &haltErr)
+		require.Equal(t, base+2, haltErr.Ledger)
+		require.NoError(t, as.Stop())
+
+		cursor, _, err = h.GetCursor("cursor-test")
+		require.NoError(t, err)
+		require.Equal(t, base+1, cursor)
+		ledgers, err := h.GetLedgers(base+1, base+2)
+		require.NoError(t, err)
+		require.Len(t, ledgers, 1)
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
+
+// TestCommitBoundedRun checks that a bounded run, such as a backfill chunk,
+// finishes once its range is written and leaves the live cursor alone.
+func TestCommitBoundedRun(t *testing.T) {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	h := db.NewDBHandler()
+
+	err := h.Transaction(func(h *db.DBHandler) error {
+		base := uint32(testLedgerBase)
+		require.NoError(t, h.UpdateCursor("bounded-test", base))
+
+		cfg := &config.AggregationConfig{
+			Network:         "bounded-test",
+			EndLedgerHeight: base + 3,
+			SkipVerify:      true,
+			FlushInterval:   10,
+			RetryTimeout:    1,
+		}
+		as := aggregation.NewTestCommitter(cfg, h, base+1, nil)
+		require.NoError(t, as.Start())
+
+		for _, seq := range []uint32{base + 2, base + 1, base + 3} {
+			as.Decoded(models.Ledger{Seq: seq, Hash: fmt.Sprintf("%064x", seq)}, nil)
+		}
+		as.FetchedAll()
+		select {
+		case <-as.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("bounded run did not finish")
+		}
+		require.NoError(t, as.Err())
+		require.Equal(t, uint64(3), as.Stats().Ledgers)
+		require.Equal(t, base+3, as.LastCommittedLedger())
+		require.NoError(t, as.Stop())
+
+		ledgers, err := h.GetLedgers(base+1, base+3)
+		require.NoError(t, err)
+		require.Len(t, ledgers, 3)
+
+		cursor, found, err := h.GetCursor("bounded-test")
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, base, cursor)
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
+
+// TestQueueBackpressure checks that the fetcher blocks once QueueSize ledgers
+// are not committed and gives up when the service stops.
+func TestQueueBackpressure(t *testing.T) {
+	w := &testWriter{}
+	release := make(chan struct{})
+	as := aggregation.NewTestCommitter(&config.AggregationConfig{
+		SkipVerify:    true,
+		QueueSize:     2,
+		FlushSize:     1,
+		FlushInterval: 60_000,
+	}, nil, 10, func(bundles []*aggregation.LedgerBundle) error {
+		<-release
+		return w.write(bundles)
+	})
+	require.NoError(t, as.Start())
+
+	// 10 is being written and no longer in flight, 11 and 12 fill the queue
+	for _, seq := range []uint32{10, 11, 12} {
+		require.True(t, as.QueueLedger(testLedgerCloseMeta(seq)))
+	}
+	require.Eventually(t, func() bool {
+		return as.InFlight() == 2
+	}, time.Second, 5*time.Millisecond)
+
+	queued := make(chan bool)
+	go func() {
+		queued <- as.QueueLedger(testLedgerCloseMeta(13))
+	}()
+	select {
+	case <-queued:
+		t.Fatal("ledger queued while the committer is stalled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- as.Stop()
+	}()
+	select {
+	case ok := <-queued:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("fetcher still blocked after stop")
+	}
+
+	// stopping drains the ledgers already queued
+	close(release)
+	select {
+	case err := <-stopped:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("committer did not stop")
+	}
+	require.Equal(t, []uint32{10, 11, 12}, w.ledgers())
+}
@@ -4,14 +4,21 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"os"
+	"os/exec"
+	"time"
 
 	"github.com/decentrio/soro-book/config"
+	"github.com/sirupsen/logrus"
 	"github.com/stellar/go/historyarchive"
 	"github.com/stellar/go/ingest/ledgerbackend"
 	"github.com/stellar/go/network"
 	"github.com/stellar/go/support/log"
 )
 
+// UserAgent is sent by captive core and the history archive clients
+const UserAgent = "sorobook"
+
 var (
 	//go:embed configs/captive-core-pubnet.cfg
 	PubnetDefaultConfig []byte
@@ -21,8 +28,17 @@ var (
 )
 
 const (
-	Pubnet  = "pubnet"
-	Testnet = "testnet"
+	Pubnet     = "pubnet"
+	Testnet    = "testnet"
+	Futurenet  = "futurenet"
+	Standalone = "standalone"
+)
+
+const (
+	CaptiveCoreBackend = "captive-core"
+	FileBackend        = "file"
+	RPCBackend         = "rpc"
+	ArchiveBackend     = "archive"
 )
 
 var (
@@ -48,6 +64,11 @@ var (
 		"https://history.stellar.org/prd/core-testnet/core_testnet_002/",
 		"https://history.stellar.org/prd/core-testnet/core_testnet_003",
 	}
+
+	// FutureNetworkhistoryArchiveURLs is a list of history archive URLs for stellar 'futurenet'
+	FutureNetworkhistoryArchiveURLs = []string{
+		"http://history-futurenet.stellar.org",
+	}
 )
 
 const (
@@ -55,10 +76,79 @@ const (
 	PublicNetworkPassphrase = "Public Global Stellar Network ; September 2015"
 	// TestNetworkPassphrase is the pass phrase used for every transaction intended for the SDF-run test network
 	TestNetworkPassphrase = "Test SDF Network ; September 2015"
+	// FutureNetworkPassphrase is the pass phrase used for every transaction intended for the SDF-run future network
+	FutureNetworkPassphrase = "Test SDF Future Network ; October 2022"
+	// StandaloneNetworkPassphrase is the pass phrase used by stellar-core in standalone mode, e.g. the quickstart image
+	StandaloneNetworkPassphrase = "Standalone Network ; February 2017"
 )
 
 func newLedgerBackend(ctx context.Context, config config.AggregationConfig, log *log.Entry) (ledgerbackend.LedgerBackend, ledgerbackend.CaptiveCoreConfig) {
 	// generate CaptiveCoreConfig
+	networkPassphrase, historyArchiveURLs, captiveCoreConfig, err := networkParams(config, log)
+	if err != nil {
+		log.Fatalf("Invalid network config: %s", err.Error())
+	}
+
+	checkpointFrequency := CheckpointFrequency(config)
+
+	coreLog, err := newCoreLogger(config.Network, config.CoreLogLevel)
+	if err != nil {
+		log.Fatalf("Invalid core log level %s: %s", config.CoreLogLevel, err.Error())
+	}
+
+	params := ledgerbackend.CaptiveCoreTomlParams{
+		NetworkPassphrase:  networkPassphrase,
+		HistoryArchiveURLs: historyArchiveURLs,
+		UseDB:              !config.CoreInMemory,
+	}
+
+	captiveConfig := ledgerbackend.CaptiveCoreConfig{
+		BinaryPath:          config.BinaryPath,
+		NetworkPassphrase:   params.NetworkPassphrase,
+		HistoryArchiveURLs:  params.HistoryArchiveURLs,
+		CheckpointFrequency: checkpointFrequency,
+		Log:                 coreLog,
+		StoragePath:         config.CoreStoragePath,
+		UserAgent:           UserAgent,
+		UseDB:               params.UseDB,
+	}
+
+	backendTypes := config.Backends
+	if len(backendTypes) == 0 {
+		backendTypes = []string{config.BackendType}
+	}
+
+	names := make([]string, len(backendTypes))
+	ledgerBackends := make([]ledgerbackend.LedgerBackend, len(backendTypes))
+	for i, backendType := range backendTypes {
+		if backendType == "" {
+			backendType = CaptiveCoreBackend
+		}
+		names[i] = backendType
+		ledgerBackends[i] = newBackend(ctx, backendType, config, captiveConfig, params, captiveCoreConfig, log)
+	}
+
+	if len(ledgerBackends) == 1 {
+		return ledgerBackends[0], captiveConfig
+	}
+
+	stallTimeout := time.Duration(config.BackendStallTimeout) * time.Second
+	primaryRetryInterval := time.Duration(config.PrimaryRetryInterval) * time.Second
+	return NewFailoverLedgerBackend(names, ledgerBackends, stallTimeout, primaryRetryInterval, log), captiveConfig
+}
+
+// CheckpointFrequency returns the checkpoint frequency of the network of
+// config, the one of the public networks by default.
+func CheckpointFrequency(config config.AggregationConfig) uint32 {
+	if config.CheckpointFrequency == 0 {
+		return historyarchive.DefaultCheckpointFrequency
+	}
+	return config.CheckpointFrequency
+}
+
+// networkParams returns the passphrase, history archives and captive core
+// config of the network, the network defaults are overridden by the config.
+func networkParams(config config.AggregationConfig, log *log.Entry) (string, []string, []byte, error) {
 	var (
 		networkPassphrase  string
 		historyArchiveURLs []string
@@ -76,52 +166,134 @@ func newLedgerBackend(ctx context.Context, config config.AggregationConfig, log
 		historyArchiveURLs = network.TestNetworkhistoryArchiveURLs
 		captiveCoreConfig = TestnetDefaultConfig
 
+	case Futurenet:
+		networkPassphrase = FutureNetworkPassphrase
+		historyArchiveURLs = FutureNetworkhistoryArchiveURLs
+
+	case Standalone:
+		networkPassphrase = StandaloneNetworkPassphrase
+
 	default:
-		log.Fatalf("Invalid network %s", config.Network)
+		// private networks are described entirely by the config
+		log.Infof("Custom network %s", config.Network)
 	}
 
-	params := ledgerbackend.CaptiveCoreTomlParams{
-		NetworkPassphrase:  networkPassphrase,
-		HistoryArchiveURLs: historyArchiveURLs,
-		UseDB:              true,
+	// Explicit config takes precedence over the network defaults
+	if config.NetworkPassphrase != "" {
+		networkPassphrase = config.NetworkPassphrase
 	}
-	captiveCoreToml, err := ledgerbackend.NewCaptiveCoreTomlFromData(captiveCoreConfig, params)
-	if err != nil {
-		log.WithError(err)
+	if len(config.HistoryArchiveURLs) > 0 {
+		historyArchiveURLs = config.HistoryArchiveURLs
+	}
+	if config.CaptiveCoreConfigPath != "" {
+		bz, err := os.ReadFile(config.CaptiveCoreConfigPath)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("invalid captive core config %s: %w", config.CaptiveCoreConfigPath, err)
+		}
+		captiveCoreConfig = bz
 	}
 
-	captiveConfig := ledgerbackend.CaptiveCoreConfig{
-		BinaryPath:          config.BinaryPath,
-		NetworkPassphrase:   params.NetworkPassphrase,
-		HistoryArchiveURLs:  params.HistoryArchiveURLs,
-		CheckpointFrequency: historyarchive.DefaultCheckpointFrequency,
-		Log:                 log.WithField("subservice", "stellar-core"),
-		Toml:                captiveCoreToml,
-		UserAgent:           "ledger-exporter",
-		UseDB:               true,
-	}
-	// Create a new captive core backend
-	backend, err := ledgerbackend.NewCaptive(captiveConfig)
-	if err != nil {
-		log.WithError(err)
+	if networkPassphrase == "" {
+		return "", nil, nil, fmt.Errorf("network %s needs a network_passphrase", config.Network)
+	}
+	if len(historyArchiveURLs) == 0 {
+		return "", nil, nil, fmt.Errorf("network %s needs history_archive_urls", config.Network)
 	}
 
-	// var ledgerRange ledgerbackend.Range
-	// if config.EndLedgerHeight == 0 {
-	// 	ledgerRange = ledgerbackend.UnboundedRange(config.StartLedgerHeight)
-	// 	log.Info("running in online mode")
-	// } else {
-	// 	ledgerRange = ledgerbackend.BoundedRange(config.StartLedgerHeight, config.EndLedgerHeight)
-	// 	log.Info("running in offline mode")
-	// }
+	return networkPassphrase, historyArchiveURLs, captiveCoreConfig, nil
+}
+
+func newBackend(
+	ctx context.Context,
+	backendType string,
+	config config.AggregationConfig,
+	captiveConfig ledgerbackend.CaptiveCoreConfig,
+	params ledgerbackend.CaptiveCoreTomlParams,
+	captiveCoreConfig []byte,
+	log *log.Entry,
+) ledgerbackend.LedgerBackend {
+	var (
+		backend ledgerbackend.LedgerBackend
+		err     error
+	)
+	switch backendType {
+	case CaptiveCoreBackend:
+		if captiveCoreConfig == nil {
+			log.Fatalf("Network %s needs a captive_core_config_path", config.Network)
+		}
+		// stellar-core is only required when ingesting through captive core
+		if captiveConfig.BinaryPath == "" {
+			captiveConfig.BinaryPath, err = exec.LookPath("stellar-core")
+			if err != nil {
+				log.Fatalf("stellar-core not found: %s", err.Error())
+			}
+		}
+		err = checkCoreVersion(ctx, captiveConfig.BinaryPath, config.RPCURL, params.NetworkPassphrase, params.HistoryArchiveURLs, captiveConfig.CheckpointFrequency)
+		if err != nil {
+			log.Fatalf("Unsupported stellar-core: %s", err.Error())
+		}
+		captiveCoreToml, err := ledgerbackend.NewCaptiveCoreTomlFromData(captiveCoreConfig, params)
+		if err != nil {
+			log.Fatalf("Invalid captive core config: %s", err.Error())
+		}
+		captiveConfig.Toml = captiveCoreToml
 
-	// err = backend.PrepareRange(ctx, ledgerRange)
+		// Create a new captive core backend
+		backend, err = ledgerbackend.NewCaptive(captiveConfig)
+		if err != nil {
+			log.Fatalf("Invalid captive core backend: %s", err.Error())
+		}
 
-	return backend, captiveConfig
+	case FileBackend:
+		backend, err = NewFileLedgerBackend(config.LedgerDir, FileSchema{
+			LedgersPerFile:    config.LedgersPerFile,
+			FilesPerPartition: config.FilesPerPartition,
+		})
+		if err != nil {
+			log.Fatalf("Invalid file backend: %s", err.Error())
+		}
+
+	case ArchiveBackend:
+		// replay the raw ledgers written by the archive stage
+		backend, err = NewFileLedgerBackend(config.ArchiveDir, ArchiveSchema)
+		if err != nil {
+			log.Fatalf("Invalid archive backend: %s", err.Error())
+		}
+
+	case RPCBackend:
+		backend, err = NewRPCLedgerBackend(config.RPCURL)
+		if err != nil {
+			log.Fatalf("Invalid rpc backend: %s", err.Error())
+		}
+
+	default:
+		log.Fatalf("Invalid backend %s", backendType)
+	}
+
+	return backend
+}
+
+// newLogger returns the logger of the aggregation service of network.
+func newLogger(network string) *log.Entry {
+	return log.New().WithField("module", "aggregation").WithField("network", network)
 }
 
-func panicIf(err error) {
+// newCoreLogger returns the logger stellar-core output is forwarded to. It
+// has the fields of the aggregation logger but a logger of its own, so its
+// level does not change the aggregation one. Core log lines keep their
+// level, lines below level are dropped.
+func newCoreLogger(network string, level string) (*log.Entry, error) {
+	coreLog := newLogger(network).WithField("subservice", "stellar-core")
+	if level == "" {
+		coreLog.SetLevel(log.InfoLevel)
+		return coreLog, nil
+	}
+
+	lvl, err := logrus.ParseLevel(level)
 	if err != nil {
-		panic(fmt.Errorf("an error occurred, panicking: %s", err))
+		return nil, err
 	}
+	coreLog.SetLevel(lvl)
+
+	return coreLog, nil
 }
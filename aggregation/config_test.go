@@ -0,0 +1,117 @@
+package aggregation_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/support/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/config"
+)
+
+func TestNetworkParams(t *testing.T) {
+	toml := filepath.Join(t.TempDir(), "captive-core.cfg")
+	require.NoError(t, os.WriteFile(toml, []byte("NETWORK_PASSPHRASE=\"custom\""), 0o600))
+	archives := []string{"http://localhost:1570"}
+
+	for _, tc := range []struct {
+		name       string
+		cfg        config.AggregationConfig
+		passphrase string
+		archives   []string
+		core       []byte
+		err        string
+	}{
+		{
+			name:       "testnet",
+			cfg:        config.AggregationConfig{Network: aggregation.Testnet},
+			passphrase: network.TestNetworkPassphrase,
+			archives:   network.TestNetworkhistoryArchiveURLs,
+			core:       aggregation.TestnetDefaultConfig,
+		},
+		{
+			name:       "futurenet",
+			cfg:        config.AggregationConfig{Network: aggregation.Futurenet},
+			passphrase: aggregation.FutureNetworkPassphrase,
+			archives:   aggregation.FutureNetworkhistoryArchiveURLs,
+		},
+		{
+			name: "standalone",
+			cfg: config.AggregationConfig{
+				Network:            aggregation.Standalone,
+				HistoryArchiveURLs: archives,
+			},
+			passphrase: aggregation.StandaloneNetworkPassphrase,
+			archives:   archives,
+		},
+		{
+			name: "custom",
+			cfg: config.AggregationConfig{
+				Network:               "private",
+				NetworkPassphrase:     "custom",
+				HistoryArchiveURLs:    archives,
+				CaptiveCoreConfigPath: toml,
+			},
+			passphrase: "custom",
+			archives:   archives,
+			core:       []byte("NETWORK_PASSPHRASE=\"custom\""),
+		},
+		{
+			name: "overridden pubnet",
+			cfg: config.AggregationConfig{
+				Network:               aggregation.Pubnet,
+				NetworkPassphrase:     "custom",
+				HistoryArchiveURLs:    archives,
+				CaptiveCoreConfigPath: toml,
+			},
+			passphrase: "custom",
+			archives:   archives,
+			core:       []byte("NETWORK_PASSPHRASE=\"custom\""),
+		},
+		{
+			name: "missing captive core config",
+			cfg: config.AggregationConfig{
+				Network:               aggregation.Testnet,
+				CaptiveCoreConfigPath: filepath.Join(t.TempDir(), "missing.cfg"),
+			},
+			err: "invalid captive core config",
+		},
+		{
+			name: "custom without passphrase",
+			cfg: config.AggregationConfig{
+				Network:            "private",
+				HistoryArchiveURLs: archives,
+			},
+			err: "network private needs a network_passphrase",
+		},
+		{
+			name: "standalone without archives",
+			cfg:  config.AggregationConfig{Network: aggregation.Standalone},
+			err:  "network standalone needs history_archive_urls",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			passphrase, archives, core, err := aggregation.NetworkParams(tc.cfg, log.New())
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.passphrase, passphrase)
+			require.Equal(t, tc.archives, archives)
+			require.Equal(t, tc.core, core)
+		})
+	}
+}
+
+func TestCursorName(t *testing.T) {
+	require.Equal(t, "testnet", aggregation.CursorName(&config.AggregationConfig{Network: aggregation.Testnet}))
+
+	// two configured networks indexing testnet
+	require.Equal(t, "testnet-a", aggregation.CursorName(&config.AggregationConfig{Network: aggregation.Testnet, Cursor: "testnet-a"}))
+	require.Equal(t, "testnet-b", aggregation.CursorName(&config.AggregationConfig{Network: aggregation.Testnet, Cursor: "testnet-b"}))
+}
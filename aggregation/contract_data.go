@@ -3,7 +3,6 @@ package aggregation
 import (
 	"fmt"
 	"math"
-	"time"
 
 	"github.com/decentrio/soro-book/database/models"
 	"github.com/google/uuid"
@@ -11,27 +10,14 @@ import (
 	"github.com/stellar/go/xdr"
 )
 
-func (as *Aggregation) contractDataEntryProcessing() {
-	for {
-		select {
-		// Receive a new tx
-		case e := <-as.contractDataEntrysQueue:
-			as.Logger.Info("getting new contract data entry")
-			as.handleReceiveNewContractDataEntry(e)
-		// Terminate process
-		case <-as.BaseService.Terminate():
-			return
-		default:
-		}
-		time.Sleep(time.Millisecond)
-	}
-}
+// contractDataNamespace scopes the ids of contract data entries
+var contractDataNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/decentrio/soro-book/contracts_data"))
 
-func (as *Aggregation) handleReceiveNewContractDataEntry(e models.ContractsData) {
-	_, err := as.db.CreateContractEntry(&e)
-	if err != nil {
-		as.Logger.Error(fmt.Sprintf("Error create contract data entry ledger %d tx %s: %s", e.Ledger, e.TxHash, err.Error()))
-	}
+// ContractDataId derives the id of a contract data entry from its natural
+// key: the ledger and transaction that wrote it and its ledger key.
+func ContractDataId(ledger uint32, txHash string, contractId string, accountId string, keyXdr []byte) string {
+	name := fmt.Appendf(nil, "%d/%s/%s/%s/", ledger, txHash, contractId, accountId)
+	return uuid.NewSHA1(contractDataNamespace, append(name, keyXdr...)).String()
 }
 
 func (tw TransactionWrapper) GetModelsContractDataEntry() []models.ContractsData {
@@ -75,7 +61,7 @@ func (tw TransactionWrapper) GetModelsContractDataEntry() []models.ContractsData
 				}
 
 				entry := models.ContractsData{
-					Id:            uuid.New().String(),
+					Id:            ContractDataId(tw.GetLedgerSequence(), tw.GetTransactionHash(), contractId, accountId, keyBz),
 					ContractId:    contractId,
 					AccountId:     accountId,
 					TxHash:        tw.GetTransactionHash(),
@@ -0,0 +1,47 @@
+package aggregation_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+)
+
+func TestContractDataId(t *testing.T) {
+	id := aggregation.ContractDataId(10, "hash", "contract", "account", []byte("key"))
+	_, err := uuid.Parse(id)
+	require.NoError(t, err)
+	require.Equal(t, id, aggregation.ContractDataId(10, "hash", "contract", "account", []byte("key")))
+
+	for _, other := range []string{
+		aggregation.ContractDataId(11, "hash", "contract", "account", []byte("key")),
+		aggregation.ContractDataId(10, "other", "contract", "account", []byte("key")),
+		aggregation.ContractDataId(10, "hash", "other", "account", []byte("key")),
+		aggregation.ContractDataId(10, "hash", "contract", "other", []byte("key")),
+		aggregation.ContractDataId(10, "hash", "contract", "account", []byte("other")),
+	} {
+		require.NotEqual(t, id, other)
+	}
+}
+
+// TestContractDataEntryIds decodes the same transaction twice, as when a
+// ledger is ingested again, and checks that its entries keep their ids.
+func TestContractDataEntryIds(t *testing.T) {
+	contract := xdr.Hash(sha256.Sum256([]byte("ids")))
+	tx := testInvokeTransaction(t, 10, contract, "set", xdr.LedgerEntryChangeTypeLedgerEntryUpdated)
+
+	var ids [2][]string
+	for i := range ids {
+		tw, err := aggregation.NewTransactionWrapperFromModel(*tx)
+		require.NoError(t, err)
+		for _, entry := range tw.GetModelsContractDataEntry() {
+			ids[i] = append(ids[i], entry.Id)
+		}
+	}
+	require.Len(t, ids[0], 1)
+	require.Equal(t, ids[0], ids[1])
+}
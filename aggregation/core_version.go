@@ -0,0 +1,89 @@
+package aggregation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// coreProtocolVersionRe matches the highest protocol supported by a
+// stellar-core binary in the output of `stellar-core version`
+var coreProtocolVersionRe = regexp.MustCompile(`ledger protocol version:\s*(\d+)`)
+
+// CoreProtocolVersion returns the highest ledger protocol supported by the
+// stellar-core binary at binaryPath.
+func CoreProtocolVersion(ctx context.Context, binaryPath string) (uint32, error) {
+	output, err := exec.CommandContext(ctx, binaryPath, "version").Output()
+	if err != nil {
+		return 0, fmt.Errorf("error run %s version: %w", binaryPath, err)
+	}
+
+	matches := coreProtocolVersionRe.FindSubmatch(output)
+	if matches == nil {
+		return 0, fmt.Errorf("no ledger protocol version in the output of %s version", binaryPath)
+	}
+
+	version, err := strconv.ParseUint(string(matches[1]), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32(version), nil
+}
+
+// NetworkProtocolVersion returns the current protocol of the network. It asks
+// the RPC server when rpcURL is set, otherwise it reads the header of the
+// latest checkpoint ledger from the history archives.
+func NetworkProtocolVersion(ctx context.Context, rpcURL string, networkPassphrase string, historyArchiveURLs []string, checkpointFrequency uint32) (uint32, error) {
+	if rpcURL != "" {
+		var result rpcGetLatestLedgerResponse
+		client := &http.Client{Timeout: DefaultRPCTimeout}
+		if err := rpcCall(ctx, client, rpcURL, "getLatestLedger", nil, &result); err != nil {
+			return 0, err
+		}
+		return result.ProtocolVersion, nil
+	}
+
+	archive, err := newHistoryArchive(ctx, networkPassphrase, historyArchiveURLs, checkpointFrequency)
+	if err != nil {
+		return 0, err
+	}
+
+	has, err := archive.GetRootHAS()
+	if err != nil {
+		return 0, fmt.Errorf("error get root history archive state: %w", err)
+	}
+
+	header, err := archive.GetLedgerHeader(has.CurrentLedger)
+	if err != nil {
+		return 0, fmt.Errorf("error get ledger header %d: %w", has.CurrentLedger, err)
+	}
+
+	return uint32(header.Header.LedgerVersion), nil
+}
+
+// checkCoreVersion makes sure the stellar-core binary can apply the ledgers
+// of the network it is about to ingest.
+func checkCoreVersion(ctx context.Context, binaryPath string, rpcURL string, networkPassphrase string, historyArchiveURLs []string, checkpointFrequency uint32) error {
+	coreVersion, err := CoreProtocolVersion(ctx, binaryPath)
+	if err != nil {
+		return err
+	}
+
+	networkVersion, err := NetworkProtocolVersion(ctx, rpcURL, networkPassphrase, historyArchiveURLs, checkpointFrequency)
+	if err != nil {
+		return fmt.Errorf("error get network protocol version: %w", err)
+	}
+
+	if coreVersion < networkVersion {
+		return fmt.Errorf(
+			"stellar-core %s supports protocol %d but the network is on protocol %d, upgrade stellar-core",
+			binaryPath, coreVersion, networkVersion,
+		)
+	}
+
+	return nil
+}
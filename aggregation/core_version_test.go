@@ -0,0 +1,125 @@
+package aggregation_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+)
+
+// stellar-core 19 printed a single ledger protocol version
+const coreVersionOutputV19 = `v19.14.0
+ledger protocol version: 19
+rust version: rustc 1.67.1 (d5a82bbd2 2023-02-07)
+`
+
+// stellar-core 22 also prints the protocols of the soroban hosts it embeds,
+// the first version is the one of stellar-core
+const coreVersionOutputV22 = `v22.1.0 (f8ca4be9b4d1d5a3b3b3e0c4a6f2c8ab6a7e2f0d)
+ledger protocol version: 22
+supports soroban: true
+rust version: rustc 1.79.0 (129f3b996 2024-06-10)
+soroban-env-host:
+    curr:
+        package version: 22.0.0
+        ledger protocol version: 22
+    prev:
+        package version: 21.2.0
+        ledger protocol version: 21
+`
+
+// testCoreBinary writes a stellar-core stand-in printing output to its
+// version command.
+func testCoreBinary(t *testing.T, output string) string {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "version.txt")
+	require.NoError(t, os.WriteFile(outputPath, []byte(output), 0o600))
+
+	binaryPath := filepath.Join(dir, "stellar-core")
+	script := fmt.Sprintf("#!/bin/sh\ncat %s\n", outputPath)
+	require.NoError(t, os.WriteFile(binaryPath, []byte(script), 0o700))
+
+	return binaryPath
+}
+
+func TestCoreProtocolVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		output  string
+		version uint32
+		err     string
+	}{
+		{"single protocol", coreVersionOutputV19, 19, ""},
+		{"soroban hosts", coreVersionOutputV22, 22, ""},
+		{"no protocol", "v15.0.0\n", 0, "no ledger protocol version"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			version, err := aggregation.CoreProtocolVersion(context.Background(), testCoreBinary(t, tc.output))
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.version, version)
+		})
+	}
+}
+
+func TestCheckCoreVersion(t *testing.T) {
+	// the network is on protocol 22
+	server := newTestRPCServer(t, 1, 100)
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name   string
+		output string
+		err    string
+	}{
+		{"supported", coreVersionOutputV22, ""},
+		{"outdated", coreVersionOutputV19, "upgrade stellar-core"},
+		{"no protocol", "v15.0.0\n", "no ledger protocol version"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := aggregation.CheckCoreVersion(context.Background(), testCoreBinary(t, tc.output), server.URL, "", nil, 0)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewCoreLogger(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		level   string
+		logged  string
+		skipped string
+	}{
+		{"default", "", "info line", "debug line"},
+		{"warn", "warn", "warn line", "info line"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			coreLog, err := aggregation.NewCoreLogger("testnet", tc.level)
+			require.NoError(t, err)
+
+			var out bytes.Buffer
+			coreLog.SetOutput(&out)
+			coreLog.Debug("debug line")
+			coreLog.Info("info line")
+			coreLog.Warn("warn line")
+			require.Contains(t, out.String(), tc.logged)
+			require.NotContains(t, out.String(), tc.skipped)
+		})
+	}
+
+	_, err := aggregation.NewCoreLogger("testnet", "verbose")
+	require.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package aggregation
+
+import (
+	"fmt"
+
+	"github.com/cenkalti/backoff/v4"
+
+	db "github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// Record types, the tables a transaction writes records to
+const (
+	RecordTransactions       = "transactions"
+	RecordInvokeTransactions = "invoke_transactions"
+	RecordCreatedContracts   = "contracts_codes"
+	RecordContractsData      = "contracts_data"
+	RecordAssetEvents        = "asset_contract_events"
+	RecordWasmEvents         = "wasm_contract_events"
+)
+
+// derivedRecordTypes are the records derived from a transaction, in the
+// order they are written
+var derivedRecordTypes = []string{
+	RecordInvokeTransactions,
+	RecordCreatedContracts,
+	RecordContractsData,
+	RecordAssetEvents,
+	RecordWasmEvents,
+}
+
+// NewDeadLetter returns the dead letter of the records of tx stored in the
+// table recordType that failed to persist with err.
+func NewDeadLetter(tx models.Transaction, recordType string, err error) models.DeadLetter {
+	return models.DeadLetter{
+		Ledger:           tx.Ledger,
+		TxHash:           tx.Hash,
+		ApplicationOrder: tx.ApplicationOrder,
+		TransactionTime:  tx.TransactionTime,
+		ModelType:        recordType,
+		EnvelopeXdr:      tx.EnvelopeXdr,
+		ResultXdr:        tx.ResultXdr,
+		ResultMetaXdr:    tx.ResultMetaXdr,
+		Error:            err.Error(),
+	}
+}
+
+// writeLedgerWithDeadLetters writes a ledger in one database transaction,
+// each record type of each transaction under its own savepoint. The records
+// the database rejects are rolled back to their savepoint and written to
+// the dead letters instead. Errors that fail the same way every time are
+// returned as backoff.Permanent.
+func (as *Aggregation) writeLedgerWithDeadLetters(b *LedgerBundle) error {
+	var deadLetters []models.DeadLetter
+	err := as.db.Transaction(func(h *db.DBHandler) error {
+		deadLetters = nil
+		if _, err := h.CreateLedger(&b.Ledger); err != nil {
+			return fmt.Errorf("error create ledger %w", err)
+		}
+
+		for _, tb := range b.Transactions {
+			for _, recordType := range append([]string{RecordTransactions}, derivedRecordTypes...) {
+				// a nested transaction is a savepoint
+				err := h.Transaction(func(h *db.DBHandler) error {
+					return writeRecords(h, tb, recordType)
+				})
+				if err == nil {
+					continue
+				}
+				if db.IsRetryable(err) {
+					return err
+				}
+
+				deadLetter := NewDeadLetter(*tb.Transaction, recordType, err)
+				if err := h.CreateDeadLetter(&deadLetter); err != nil {
+					return fmt.Errorf("error create dead letter %w", err)
+				}
+				deadLetters = append(deadLetters, deadLetter)
+			}
+		}
+
+		// bounded runs such as backfill chunks leave the live cursor alone
+		if as.EndLedgerSeq == 0 {
+			return h.UpdateCursor(as.cursorName(), b.Ledger.Seq)
+		}
+		return nil
+	})
+	if err != nil && !db.IsRetryable(err) {
+		return backoff.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, deadLetter := range deadLetters {
+		as.Logger.Error(fmt.Sprintf("Error persist %s of ledger %d tx %s, dead letter %d: %s",
+			deadLetter.ModelType, deadLetter.Ledger, deadLetter.TxHash, deadLetter.Id, deadLetter.Error))
+	}
+	as.committedLedgers([]*LedgerBundle{b})
+	return nil
+}
+
+// RetryDeadLetter decodes the transaction of a dead letter again, applies
+// filter and writes the records of its type. The dead letter is removed in
+// the same database transaction.
+func RetryDeadLetter(h *db.DBHandler, deadLetter models.DeadLetter, filter *ContractFilter) error {
+	tw, err := NewTransactionWrapperFromModel(models.Transaction{
+		Hash:             deadLetter.TxHash,
+		Ledger:           deadLetter.Ledger,
+		ApplicationOrder: deadLetter.ApplicationOrder,
+		EnvelopeXdr:      deadLetter.EnvelopeXdr,
+		ResultXdr:        deadLetter.ResultXdr,
+		ResultMetaXdr:    deadLetter.ResultMetaXdr,
+		TransactionTime:  deadLetter.TransactionTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	b, err := NewTransactionBundle(tw, filter)
+	if err != nil {
+		return &DecodeError{Ledger: deadLetter.Ledger, TxHash: deadLetter.TxHash, Err: err}
+	}
+
+	return h.Transaction(func(h *db.DBHandler) error {
+		if err := writeRecords(h, b, deadLetter.ModelType); err != nil {
+			return err
+		}
+		// entries written since may supersede the restored ones
+		if deadLetter.ModelType == RecordContractsData {
+			if err := h.RecomputeNewestContractData(deadLetter.Ledger, deadLetter.Ledger); err != nil {
+				return err
+			}
+		}
+
+		return h.DeleteDeadLetter(deadLetter.Id)
+	})
+}
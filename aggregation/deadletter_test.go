@@ -0,0 +1,97 @@
+package aggregation_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/config"
+	db "github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+func TestDeadLetter(t *testing.T) {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	h := db.NewDBHandler()
+
+	contract := xdr.Hash(sha256.Sum256([]byte("deadletter")))
+	contractId, err := strkey.Encode(strkey.VersionByteContract, contract[:])
+	require.NoError(t, err)
+
+	err = h.Transaction(func(h *db.DBHandler) error {
+		seq := uint32(testLedgerBase + 1)
+		// postgres rejects a NUL byte in the function name of the invocation
+		tx := testInvokeTransaction(t, seq, contract, "set\x00", xdr.LedgerEntryChangeTypeLedgerEntryCreated)
+		tw, err := aggregation.NewTransactionWrapperFromModel(*tx)
+		require.NoError(t, err)
+		tb, err := aggregation.NewTransactionBundle(tw, nil)
+		require.NoError(t, err)
+		require.Len(t, tb.InvokeTransactions, 1)
+
+		as := aggregation.NewTestCommitter(&config.AggregationConfig{
+			Network:       "deadletter-test",
+			SkipVerify:    true,
+			FlushInterval: 10,
+		}, h, seq, nil)
+		require.NoError(t, as.Start())
+		as.DecodedBundle(&aggregation.LedgerBundle{
+			Ledger:       models.Ledger{Seq: seq, Hash: fmt.Sprintf("%064x", seq)},
+			Transactions: []aggregation.TransactionBundle{tb},
+		})
+		require.Eventually(t, func() bool {
+			return as.LastCommittedLedger() == seq
+		}, 5*time.Second, 10*time.Millisecond)
+		require.NoError(t, as.Stop())
+		require.NoError(t, as.Err())
+
+		// the rest of the ledger is committed
+		txs, err := h.GetTransactions(seq, seq)
+		require.NoError(t, err)
+		require.Len(t, txs, 1)
+		entries, err := h.GetContractData(contractId)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		var deadLetter *models.DeadLetter
+		deadLetters, err := h.GetDeadLetters()
+		require.NoError(t, err)
+		for i := range deadLetters {
+			if deadLetters[i].TxHash == tx.Hash {
+				require.Nil(t, deadLetter, "one dead letter expected")
+				deadLetter = &deadLetters[i]
+			}
+		}
+		require.NotNil(t, deadLetter)
+		require.Equal(t, aggregation.RecordInvokeTransactions, deadLetter.ModelType)
+		require.Equal(t, seq, deadLetter.Ledger)
+		require.Equal(t, tx.EnvelopeXdr, deadLetter.EnvelopeXdr)
+		require.Equal(t, tx.ResultXdr, deadLetter.ResultXdr)
+		require.Equal(t, tx.ResultMetaXdr, deadLetter.ResultMetaXdr)
+		require.NotEmpty(t, deadLetter.Error)
+
+		// the record still fails, the dead letter is kept
+		require.Error(t, aggregation.RetryDeadLetter(h, *deadLetter, nil))
+		kept, err := h.GetDeadLetters(deadLetter.Id)
+		require.NoError(t, err)
+		require.Len(t, kept, 1)
+
+		// once the contract is excluded there is nothing left to write
+		filter := aggregation.NewContractFilter(config.FilterConfig{ExcludeContracts: []string{contractId}})
+		require.NoError(t, aggregation.RetryDeadLetter(h, *deadLetter, filter))
+		kept, err = h.GetDeadLetters(deadLetter.Id)
+		require.NoError(t, err)
+		require.Empty(t, kept)
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
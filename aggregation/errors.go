@@ -0,0 +1,99 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	DefaultRetryTimeout = 5 * time.Minute
+)
+
+// ErrRetryTimeout is returned once a transient error kept failing for the
+// whole retry timeout.
+var ErrRetryTimeout = errors.New("retry timeout")
+
+// DecodeError is a ledger or one of its transactions that cannot be
+// decoded, retrying does not help. TxHash is empty when the ledger itself
+// is invalid.
+type DecodeError struct {
+	Ledger uint32
+	TxHash string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.TxHash == "" {
+		return fmt.Sprintf("error decode ledger %d: %s", e.Ledger, e.Err.Error())
+	}
+	return fmt.Sprintf("error decode ledger %d tx %s: %s", e.Ledger, e.TxHash, e.Err.Error())
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// HaltError ends ingestion, Ledger is the first ledger that is not
+// committed. Ingestion resumes from it once the cause is fixed.
+type HaltError struct {
+	Ledger uint32
+	Err    error
+}
+
+func (e *HaltError) Error() string {
+	return fmt.Sprintf("ingestion halted at ledger %d: %s", e.Ledger, e.Err.Error())
+}
+
+func (e *HaltError) Unwrap() error {
+	return e.Err
+}
+
+// newBackOff returns the exponential backoff transient errors are retried
+// with, it gives up after the retry timeout.
+func (as *Aggregation) newBackOff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = time.Duration(as.ACfg.RetryTimeout) * time.Second
+	if b.MaxElapsedTime == 0 {
+		b.MaxElapsedTime = DefaultRetryTimeout
+	}
+	return b
+}
+
+// retry calls fn until it succeeds, returns a backoff.Permanent error, the
+// retry timeout elapses or stop is closed. It returns the last error of fn.
+func (as *Aggregation) retry(stop <-chan struct{}, op string, fn func() error) error {
+	b := as.newBackOff()
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var permanent *backoff.PermanentError
+		if errors.As(err, &permanent) {
+			return permanent.Err
+		}
+
+		wait := b.NextBackOff()
+		if wait == backoff.Stop {
+			return fmt.Errorf("%w of %s exceeded: %w", ErrRetryTimeout, b.MaxElapsedTime, err)
+		}
+		as.Logger.Error(fmt.Sprintf("Error %s, retry in %s: %s", op, wait, err.Error()))
+
+		select {
+		case <-stop:
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// halt stops fetching at ledger seq, the ledgers fetched before it are
+// still committed.
+func (as *Aggregation) halt(seq uint32, err error) {
+	err = &HaltError{Ledger: seq, Err: err}
+	as.Logger.Error(err.Error())
+	as.finish(err)
+}
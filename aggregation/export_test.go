@@ -0,0 +1,131 @@
+package aggregation
+
+import (
+	"github.com/stellar/go/support/log"
+	"github.com/stellar/go/xdr"
+
+	"github.com/decentrio/soro-book/config"
+	db "github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+	"github.com/decentrio/soro-book/lib/service"
+)
+
+var (
+	VerifyHeader      = verifyHeader
+	VerifyTxSetResult = verifyTxSetResult
+	VerifyChain       = verifyChain
+	NetworkParams     = networkParams
+	CheckCoreVersion  = checkCoreVersion
+	NewCoreLogger     = newCoreLogger
+)
+
+// committer runs the committer of an aggregation alone, ledgers are handed
+// to it with Decoded instead of being fetched and decoded. Ledgers queued
+// with QueueLedger reach it with their sequence only.
+type committer struct {
+	*Aggregation
+}
+
+func (c committer) OnStart() error {
+	go c.commitProcessing()
+	go c.ledgerHeaders()
+	return nil
+}
+
+// ledgerHeaders stands in for the decode workers.
+func (c committer) ledgerHeaders() {
+	for {
+		select {
+		case l := <-c.ledgerQueue:
+			c.bundleQueue <- &LedgerBundle{Ledger: models.Ledger{Seq: l.LedgerSequence()}}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// OnStop drains the ledgers handed to the committer before stopping it.
+func (c committer) OnStop() error {
+	c.pending.Wait()
+	close(c.quit)
+	return nil
+}
+
+// NewTestCommitter returns an aggregation that only commits ledgers, from
+// ledger start on, up to cfg.EndLedgerHeight when it is set. Ledgers are written to h, or by write when it is set.
+func NewTestCommitter(
+	cfg *config.AggregationConfig,
+	h *db.DBHandler,
+	start uint32,
+	write func(bundles []*LedgerBundle) error,
+) *Aggregation {
+	queueSize := int(cfg.QueueSize)
+	if queueSize == 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	as := &Aggregation{
+		ledgerQueue:    make(chan xdr.LedgerCloseMeta, queueSize),
+		bundleQueue:    make(chan *LedgerBundle, queueSize),
+		inFlight:       make(chan struct{}, queueSize),
+		fetchDone:      make(chan struct{}),
+		done:           make(chan struct{}),
+		fetchStopped:   make(chan struct{}),
+		quit:           make(chan struct{}),
+		ACfg:           cfg,
+		db:             h,
+		StartLedgerSeq: start,
+		EndLedgerSeq:   cfg.EndLedgerHeight,
+		nextCommitSeq:  start,
+	}
+	as.BaseService = *service.NewBaseService("Committer", committer{as})
+	as.BaseService.SetLogger(log.New().WithField("module", "committer"))
+
+	as.write = as.writeLedgers
+	if write != nil {
+		as.write = func(bundles []*LedgerBundle, batchSize int) error {
+			if err := write(bundles); err != nil {
+				return err
+			}
+			as.committedLedgers(bundles)
+			return nil
+		}
+	}
+
+	return as
+}
+
+// FetchedAll finishes the run as the fetcher does once the last ledger of a
+// bounded range is queued.
+func (as *Aggregation) FetchedAll() {
+	as.finish(nil)
+}
+
+// QueueLedger queues l as the fetcher does, it returns false if the
+// committer is stopped while waiting for room.
+func (as *Aggregation) QueueLedger(l xdr.LedgerCloseMeta) bool {
+	return as.queueLedger(l)
+}
+
+// Decoded hands ledger to the committer as if a decode worker decoded it,
+// a non nil err fails its decoding.
+func (as *Aggregation) Decoded(ledger models.Ledger, err error) {
+	b := &LedgerBundle{Ledger: ledger}
+	if err != nil {
+		b.err = &DecodeError{Ledger: ledger.Seq, Err: err}
+	}
+	as.DecodedBundle(b)
+}
+
+// DecodedBundle hands a decoded ledger and its transactions to the committer.
+func (as *Aggregation) DecodedBundle(b *LedgerBundle) {
+	as.inFlight <- struct{}{}
+	as.pending.Add(1)
+	as.bundleQueue <- b
+}
+
+// InFlight returns the number of ledgers queued and not committed yet that
+// hold back the fetcher.
+func (as *Aggregation) InFlight() int {
+	return len(as.inFlight)
+}
@@ -0,0 +1,254 @@
+package aggregation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/support/log"
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	DefaultBackendStallTimeout  = 60 * time.Second
+	DefaultPrimaryRetryInterval = 5 * time.Minute
+)
+
+// FailoverLedgerBackend reads ledgers from an ordered list of backends. It
+// serves from the first one that works, moves to the next one when a
+// backend errors or stalls, and periodically prepares the primary, the
+// first backend of the list, in the background to go back to it.
+type FailoverLedgerBackend struct {
+	names    []string
+	backends []backends.LedgerBackend
+	log      *log.Entry
+
+	stallTimeout         time.Duration
+	primaryRetryInterval time.Duration
+
+	current     int
+	failedAt    time.Time
+	ledgerRange backends.Range
+	prepared    bool
+
+	// probe receives the result of preparing the primary in the background
+	probe       chan error
+	cancelProbe context.CancelFunc
+}
+
+var _ backends.LedgerBackend = (*FailoverLedgerBackend)(nil)
+
+func NewFailoverLedgerBackend(
+	names []string,
+	ledgerBackends []backends.LedgerBackend,
+	stallTimeout time.Duration,
+	primaryRetryInterval time.Duration,
+	log *log.Entry,
+) *FailoverLedgerBackend {
+	if stallTimeout == 0 {
+		stallTimeout = DefaultBackendStallTimeout
+	}
+	if primaryRetryInterval == 0 {
+		primaryRetryInterval = DefaultPrimaryRetryInterval
+	}
+
+	return &FailoverLedgerBackend{
+		names:                names,
+		backends:             ledgerBackends,
+		log:                  log.WithField("subservice", "failover"),
+		stallTimeout:         stallTimeout,
+		primaryRetryInterval: primaryRetryInterval,
+	}
+}
+
+func (b *FailoverLedgerBackend) GetLatestLedgerSequence(ctx context.Context) (uint32, error) {
+	var errs []error
+	for i := range b.backends {
+		idx := (b.current + i) % len(b.backends)
+		latest, err := b.backends[idx].GetLatestLedgerSequence(ctx)
+		if err == nil {
+			return latest, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", b.names[idx], err))
+	}
+
+	return 0, errors.Join(errs...)
+}
+
+// PrepareRange prepares the first backend of the list that accepts the range.
+func (b *FailoverLedgerBackend) PrepareRange(ctx context.Context, ledgerRange backends.Range) error {
+	b.stopProbe()
+	b.ledgerRange = ledgerRange
+
+	var errs []error
+	for idx, backend := range b.backends {
+		err := backend.PrepareRange(ctx, ledgerRange)
+		if err == nil {
+			b.switchTo(idx)
+			b.prepared = true
+			return nil
+		}
+
+		b.log.Errorf("error prepare %s on %s: %s", ledgerRange.String(), b.names[idx], err.Error())
+		errs = append(errs, fmt.Errorf("%s: %w", b.names[idx], err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (b *FailoverLedgerBackend) IsPrepared(ctx context.Context, ledgerRange backends.Range) (bool, error) {
+	if !b.prepared {
+		return false, nil
+	}
+
+	return b.backends[b.current].IsPrepared(ctx, ledgerRange)
+}
+
+// GetLedger returns the ledger from the current backend and fails over to
+// the next ones, in order, when it errors or takes longer than the stall
+// timeout.
+func (b *FailoverLedgerBackend) GetLedger(ctx context.Context, seq uint32) (xdr.LedgerCloseMeta, error) {
+	if !b.prepared {
+		return xdr.LedgerCloseMeta{}, fmt.Errorf("session is not prepared, call PrepareRange first")
+	}
+
+	b.checkPrimary(seq)
+
+	var errs []error
+	start := b.current
+	for i := range b.backends {
+		idx := (start + i) % len(b.backends)
+		// the probe is preparing the primary
+		if idx == 0 && b.probe != nil {
+			continue
+		}
+		if idx != b.current {
+			if err := b.prepareFrom(ctx, idx, seq); err != nil {
+				b.log.Errorf("error prepare ledger %d on %s: %s", seq, b.names[idx], err.Error())
+				errs = append(errs, fmt.Errorf("%s: %w", b.names[idx], err))
+				continue
+			}
+			b.log.Infof("failover from %s to %s at ledger %d", b.names[b.current], b.names[idx], seq)
+			b.switchTo(idx)
+		}
+
+		lcm, err := b.getLedger(ctx, idx, seq)
+		if err == nil {
+			b.log.Debugf("ledger %d served by %s", seq, b.names[idx])
+			return lcm, nil
+		}
+		if ctx.Err() != nil {
+			return xdr.LedgerCloseMeta{}, ctx.Err()
+		}
+
+		b.log.Errorf("error get ledger %d from %s: %s", seq, b.names[idx], err.Error())
+		errs = append(errs, fmt.Errorf("%s: %w", b.names[idx], err))
+	}
+
+	return xdr.LedgerCloseMeta{}, errors.Join(errs...)
+}
+
+func (b *FailoverLedgerBackend) Close() error {
+	b.stopProbe()
+
+	var errs []error
+	for idx, backend := range b.backends {
+		if err := backend.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.names[idx], err))
+		}
+	}
+	b.prepared = false
+
+	return errors.Join(errs...)
+}
+
+func (b *FailoverLedgerBackend) switchTo(idx int) {
+	if idx != 0 && b.current == 0 {
+		b.failedAt = time.Now()
+	}
+	b.current = idx
+}
+
+// checkPrimary goes back to the primary once a probe prepared it, and starts
+// a probe when the primary had time to recover. Preparing a backend such as
+// captive core takes minutes, so the probe runs in the background and the
+// ledgers keep being served by the current backend meanwhile.
+func (b *FailoverLedgerBackend) checkPrimary(seq uint32) {
+	if b.probe != nil {
+		select {
+		case err := <-b.probe:
+			b.probe = nil
+			b.cancelProbe()
+			if err != nil {
+				b.log.Errorf("primary backend %s is still failing: %s", b.names[0], err.Error())
+				b.failedAt = time.Now()
+				return
+			}
+			b.log.Infof("back to primary backend %s at ledger %d", b.names[0], seq)
+			b.switchTo(0)
+		default:
+		}
+		return
+	}
+
+	if b.current == 0 || time.Since(b.failedAt) <= b.primaryRetryInterval {
+		return
+	}
+
+	// the primary reads forward from seq, later ledgers are served too
+	ledgerRange := b.rangeFrom(seq)
+	ctx, cancel := context.WithCancel(context.Background())
+	probe := make(chan error, 1)
+	b.probe = probe
+	b.cancelProbe = cancel
+	go func() {
+		probe <- b.backends[0].PrepareRange(ctx, ledgerRange)
+	}()
+}
+
+// stopProbe cancels the running probe of the primary and waits for it.
+func (b *FailoverLedgerBackend) stopProbe() {
+	if b.probe == nil {
+		return
+	}
+
+	b.cancelProbe()
+	<-b.probe
+	b.probe = nil
+}
+
+// rangeFrom returns the rest of the prepared range, starting at seq.
+func (b *FailoverLedgerBackend) rangeFrom(seq uint32) backends.Range {
+	if b.ledgerRange.Bounded() {
+		return backends.BoundedRange(seq, b.ledgerRange.To())
+	}
+
+	return backends.UnboundedRange(seq)
+}
+
+// prepareFrom prepares backend idx for the rest of the range, starting at seq.
+func (b *FailoverLedgerBackend) prepareFrom(ctx context.Context, idx int, seq uint32) error {
+	ledgerRange := b.rangeFrom(seq)
+
+	prepared, err := b.backends[idx].IsPrepared(ctx, ledgerRange)
+	if err == nil && prepared {
+		return nil
+	}
+
+	return b.backends[idx].PrepareRange(ctx, ledgerRange)
+}
+
+// getLedger calls GetLedger on backend idx and gives up after the stall timeout.
+func (b *FailoverLedgerBackend) getLedger(ctx context.Context, idx int, seq uint32) (xdr.LedgerCloseMeta, error) {
+	stallCtx, cancel := context.WithTimeout(ctx, b.stallTimeout)
+	defer cancel()
+
+	lcm, err := b.backends[idx].GetLedger(stallCtx, seq)
+	if err != nil && stallCtx.Err() == context.DeadlineExceeded {
+		return lcm, fmt.Errorf("stalled for %s: %w", b.stallTimeout, err)
+	}
+
+	return lcm, err
+}
@@ -0,0 +1,152 @@
+package aggregation_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/support/log"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+)
+
+func TestFailoverLedgerBackend(t *testing.T) {
+	// the file backend only has ledgers up to 29 and stalls after them
+	dir := t.TempDir()
+	schema := aggregation.FileSchema{LedgersPerFile: 10, FilesPerPartition: 2}
+	writeTestBatch(t, dir, schema, 20)
+	fileBackend, err := aggregation.NewFileLedgerBackend(dir, schema)
+	require.NoError(t, err)
+
+	server := newTestRPCServer(t, 10, 500)
+	defer server.Close()
+	rpcBackend, err := aggregation.NewRPCLedgerBackend(server.URL)
+	require.NoError(t, err)
+
+	backend := aggregation.NewFailoverLedgerBackend(
+		[]string{aggregation.FileBackend, aggregation.RPCBackend},
+		[]backends.LedgerBackend{fileBackend, rpcBackend},
+		100*time.Millisecond,
+		time.Hour,
+		log.New(),
+	)
+
+	ctx := context.Background()
+	require.NoError(t, backend.PrepareRange(ctx, backends.UnboundedRange(25)))
+	for seq := uint32(25); seq <= 40; seq++ {
+		lcm, err := backend.GetLedger(ctx, seq)
+		require.NoError(t, err)
+		require.Equal(t, seq, lcm.LedgerSequence())
+	}
+}
+
+// testPrimaryBackend fails to prepare while down and otherwise prepares once
+// release is closed.
+type testPrimaryBackend struct {
+	mu      sync.Mutex
+	down    bool
+	release chan struct{}
+	served  int
+}
+
+func (b *testPrimaryBackend) setDown(down bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = down
+}
+
+func (b *testPrimaryBackend) servedLedgers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.served
+}
+
+func (b *testPrimaryBackend) GetLatestLedgerSequence(ctx context.Context) (uint32, error) {
+	return 0, errors.New("not prepared")
+}
+
+func (b *testPrimaryBackend) GetLedger(ctx context.Context, seq uint32) (xdr.LedgerCloseMeta, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.served++
+	return testLedgerCloseMeta(seq), nil
+}
+
+func (b *testPrimaryBackend) PrepareRange(ctx context.Context, ledgerRange backends.Range) error {
+	b.mu.Lock()
+	down := b.down
+	b.mu.Unlock()
+	if down {
+		return errors.New("down")
+	}
+
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *testPrimaryBackend) IsPrepared(ctx context.Context, ledgerRange backends.Range) (bool, error) {
+	return false, nil
+}
+
+func (b *testPrimaryBackend) Close() error {
+	return nil
+}
+
+func TestFailoverLedgerBackendBackToPrimary(t *testing.T) {
+	primary := &testPrimaryBackend{down: true, release: make(chan struct{})}
+
+	server := newTestRPCServer(t, 10, 500)
+	defer server.Close()
+	rpcBackend, err := aggregation.NewRPCLedgerBackend(server.URL)
+	require.NoError(t, err)
+
+	backend := aggregation.NewFailoverLedgerBackend(
+		[]string{"primary", aggregation.RPCBackend},
+		[]backends.LedgerBackend{primary, rpcBackend},
+		time.Second,
+		10*time.Millisecond,
+		log.New(),
+	)
+	defer backend.Close()
+
+	ctx := context.Background()
+	require.NoError(t, backend.PrepareRange(ctx, backends.UnboundedRange(20)))
+
+	seq := uint32(20)
+	getLedger := func() {
+		lcm, err := backend.GetLedger(ctx, seq)
+		require.NoError(t, err)
+		require.Equal(t, seq, lcm.LedgerSequence())
+		seq++
+	}
+
+	// a failed probe keeps the fallback
+	time.Sleep(20 * time.Millisecond)
+	getLedger()
+	getLedger()
+
+	// the probe blocks on the primary preparing, ledgers are still served
+	primary.setDown(false)
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		getLedger()
+	}
+	require.Zero(t, primary.servedLedgers())
+
+	close(primary.release)
+	deadline := time.Now().Add(time.Second)
+	for primary.servedLedgers() == 0 {
+		require.True(t, time.Now().Before(deadline), "primary backend is not used again")
+		getLedger()
+		time.Sleep(time.Millisecond)
+	}
+}
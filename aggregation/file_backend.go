@@ -0,0 +1,261 @@
+package aggregation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	// FileSuffix is the extension used by the ledger exporter for
+	// zstd compressed LedgerCloseMetaBatch files
+	FileSuffix = ".xdr.zstd"
+
+	DefaultLedgersPerFile    = uint32(1)
+	DefaultFilesPerPartition = uint32(64000)
+	DefaultFilePollInterval  = time.Second
+)
+
+// FileSchema describes how ledgers are grouped into files and files into
+// partitions. It follows the datastore layout of the Stellar ledger exporter.
+type FileSchema struct {
+	LedgersPerFile    uint32
+	FilesPerPartition uint32
+}
+
+// StartBoundary returns the first ledger stored in the file holding seq.
+func (s FileSchema) StartBoundary(seq uint32) uint32 {
+	if s.LedgersPerFile == 0 {
+		return 0
+	}
+	return (seq / s.LedgersPerFile) * s.LedgersPerFile
+}
+
+// EndBoundary returns the last ledger stored in the file holding seq.
+func (s FileSchema) EndBoundary(seq uint32) uint32 {
+	return s.StartBoundary(seq) + s.LedgersPerFile - 1
+}
+
+// ObjectKey returns the path, relative to the root directory, of the file
+// holding seq.
+func (s FileSchema) ObjectKey(seq uint32) string {
+	var key string
+	if s.FilesPerPartition > 1 {
+		partitionSize := s.LedgersPerFile * s.FilesPerPartition
+		partitionStart := (seq / partitionSize) * partitionSize
+		partitionEnd := partitionStart + partitionSize - 1
+		key = fmt.Sprintf("%08X--%d-%d/", math.MaxUint32-partitionStart, partitionStart, partitionEnd)
+	}
+
+	fileStart := s.StartBoundary(seq)
+	fileEnd := s.EndBoundary(seq)
+	key += fmt.Sprintf("%08X--%d", math.MaxUint32-fileStart, fileStart)
+	if fileStart != fileEnd {
+		key += fmt.Sprintf("-%d", fileEnd)
+	}
+
+	return key + FileSuffix
+}
+
+// FileLedgerBackend is a ledger backend that reads compressed
+// LedgerCloseMetaBatch files from a local directory, e.g. a mirror of the
+// files written by the Stellar ledger exporter.
+type FileLedgerBackend struct {
+	dir          string
+	schema       FileSchema
+	pollInterval time.Duration
+
+	ledgerRange backends.Range
+	prepared    bool
+
+	// batch is the last decoded file, most reads hit it
+	batch  xdr.LedgerCloseMetaBatch
+	loaded bool
+}
+
+var _ backends.LedgerBackend = (*FileLedgerBackend)(nil)
+
+func NewFileLedgerBackend(dir string, schema FileSchema) (*FileLedgerBackend, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("ledger directory is not set")
+	}
+	if schema.LedgersPerFile == 0 {
+		schema.LedgersPerFile = DefaultLedgersPerFile
+	}
+	if schema.FilesPerPartition == 0 {
+		schema.FilesPerPartition = DefaultFilesPerPartition
+	}
+
+	return &FileLedgerBackend{
+		dir:          dir,
+		schema:       schema,
+		pollInterval: DefaultFilePollInterval,
+	}, nil
+}
+
+// GetLatestLedgerSequence returns the last ledger found in the directory.
+func (b *FileLedgerBackend) GetLatestLedgerSequence(ctx context.Context) (uint32, error) {
+	var latest uint32
+	err := filepath.WalkDir(b.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), FileSuffix) {
+			return nil
+		}
+
+		end, ok := parseFileEndLedger(d.Name())
+		if ok && end > latest {
+			latest = end
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return 0, err
+	}
+	if latest == 0 {
+		return 0, fmt.Errorf("no ledger files found in %s", b.dir)
+	}
+
+	return latest, nil
+}
+
+// PrepareRange only records the range, files are read lazily by GetLedger.
+func (b *FileLedgerBackend) PrepareRange(ctx context.Context, ledgerRange backends.Range) error {
+	if !ledgerRange.Bounded() {
+		b.ledgerRange = ledgerRange
+		b.prepared = true
+		return nil
+	}
+
+	// a bounded range must already be fully available on disk
+	_, err := os.Stat(filepath.Join(b.dir, b.schema.ObjectKey(ledgerRange.To())))
+	if err != nil {
+		return fmt.Errorf("ledger %d not available: %w", ledgerRange.To(), err)
+	}
+
+	b.ledgerRange = ledgerRange
+	b.prepared = true
+	return nil
+}
+
+func (b *FileLedgerBackend) IsPrepared(ctx context.Context, ledgerRange backends.Range) (bool, error) {
+	if !b.prepared {
+		return false, nil
+	}
+
+	return b.ledgerRange.Contains(ledgerRange), nil
+}
+
+// GetLedger returns the ledger with the given sequence. In an unbounded range
+// it waits for the file to appear, which lets sorobook follow a directory that
+// is still being written to.
+func (b *FileLedgerBackend) GetLedger(ctx context.Context, seq uint32) (xdr.LedgerCloseMeta, error) {
+	if !b.prepared {
+		return xdr.LedgerCloseMeta{}, fmt.Errorf("session is not prepared, call PrepareRange first")
+	}
+	if seq < b.ledgerRange.From() || (b.ledgerRange.Bounded() && seq > b.ledgerRange.To()) {
+		return xdr.LedgerCloseMeta{}, fmt.Errorf("ledger %d is outside of the prepared range %s", seq, b.ledgerRange.String())
+	}
+
+	if !b.contains(seq) {
+		path := filepath.Join(b.dir, b.schema.ObjectKey(seq))
+		for {
+			err := b.load(path)
+			if err == nil {
+				break
+			}
+			if !os.IsNotExist(err) || b.ledgerRange.Bounded() {
+				return xdr.LedgerCloseMeta{}, err
+			}
+
+			select {
+			case <-ctx.Done():
+				return xdr.LedgerCloseMeta{}, ctx.Err()
+			case <-time.After(b.pollInterval):
+			}
+		}
+
+		if !b.contains(seq) {
+			return xdr.LedgerCloseMeta{}, fmt.Errorf("file %s does not contain ledger %d", path, seq)
+		}
+	}
+
+	return b.batch.LedgerCloseMetas[seq-uint32(b.batch.StartSequence)], nil
+}
+
+func (b *FileLedgerBackend) Close() error {
+	b.prepared = false
+	b.loaded = false
+	return nil
+}
+
+func (b *FileLedgerBackend) contains(seq uint32) bool {
+	return b.loaded &&
+		seq >= uint32(b.batch.StartSequence) &&
+		seq <= uint32(b.batch.EndSequence) &&
+		int(seq-uint32(b.batch.StartSequence)) < len(b.batch.LedgerCloseMetas)
+}
+
+func (b *FileLedgerBackend) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	batch, err := readLedgerCloseMetaBatch(f)
+	if err != nil {
+		return fmt.Errorf("error decode %s: %w", path, err)
+	}
+
+	b.batch = batch
+	b.loaded = true
+	return nil
+}
+
+func readLedgerCloseMetaBatch(r io.Reader) (xdr.LedgerCloseMetaBatch, error) {
+	var batch xdr.LedgerCloseMetaBatch
+
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return batch, err
+	}
+	defer decoder.Close()
+
+	bz, err := io.ReadAll(decoder)
+	if err != nil {
+		return batch, err
+	}
+
+	err = batch.UnmarshalBinary(bz)
+	return batch, err
+}
+
+// parseFileEndLedger extracts the last ledger from a file name such as
+// "FFFFFFFE--1-9.xdr.zstd" or "FFFFFFFE--1.xdr.zstd".
+func parseFileEndLedger(name string) (uint32, bool) {
+	parts := strings.SplitN(strings.TrimSuffix(name, FileSuffix), "--", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+
+	bounds := strings.Split(parts[1], "-")
+	end, err := strconv.ParseUint(bounds[len(bounds)-1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint32(end), true
+}
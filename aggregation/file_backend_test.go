@@ -0,0 +1,106 @@
+package aggregation_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+)
+
+func testLedgerCloseMeta(seq uint32) xdr.LedgerCloseMeta {
+	return xdr.LedgerCloseMeta{
+		V: 0,
+		V0: &xdr.LedgerCloseMetaV0{
+			LedgerHeader: xdr.LedgerHeaderHistoryEntry{
+				Header: xdr.LedgerHeader{LedgerSeq: xdr.Uint32(seq)},
+			},
+		},
+	}
+}
+
+func writeTestBatch(t *testing.T, dir string, schema aggregation.FileSchema, from uint32) {
+	batch := xdr.LedgerCloseMetaBatch{
+		StartSequence: xdr.Uint32(schema.StartBoundary(from)),
+		EndSequence:   xdr.Uint32(schema.EndBoundary(from)),
+	}
+	for seq := schema.StartBoundary(from); seq <= schema.EndBoundary(from); seq++ {
+		batch.LedgerCloseMetas = append(batch.LedgerCloseMetas, testLedgerCloseMeta(seq))
+	}
+	bz, err := batch.MarshalBinary()
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, schema.ObjectKey(from))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	encoder, err := zstd.NewWriter(f)
+	require.NoError(t, err)
+	_, err = encoder.Write(bz)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Close())
+}
+
+func TestFileSchemaObjectKey(t *testing.T) {
+	schema := aggregation.FileSchema{LedgersPerFile: 1, FilesPerPartition: 64000}
+	require.Equal(t, "FFFFFFFF--0-63999/FFFFFFF5--10.xdr.zstd", schema.ObjectKey(10))
+
+	schema = aggregation.FileSchema{LedgersPerFile: 10, FilesPerPartition: 1}
+	require.Equal(t, "FFFFFFF5--10-19.xdr.zstd", schema.ObjectKey(15))
+}
+
+func TestFileLedgerBackend(t *testing.T) {
+	dir := t.TempDir()
+	schema := aggregation.FileSchema{LedgersPerFile: 10, FilesPerPartition: 2}
+	writeTestBatch(t, dir, schema, 10)
+	writeTestBatch(t, dir, schema, 20)
+
+	backend, err := aggregation.NewFileLedgerBackend(dir, schema)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	latest, err := backend.GetLatestLedgerSequence(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(29), latest)
+
+	require.Error(t, backend.PrepareRange(ctx, backends.BoundedRange(10, 35)))
+	require.NoError(t, backend.PrepareRange(ctx, backends.BoundedRange(12, 25)))
+
+	for seq := uint32(12); seq <= 25; seq++ {
+		lcm, err := backend.GetLedger(ctx, seq)
+		require.NoError(t, err)
+		require.Equal(t, seq, lcm.LedgerSequence())
+	}
+
+	_, err = backend.GetLedger(ctx, 26)
+	require.Error(t, err)
+}
+
+func TestLedgerArchiveReplay(t *testing.T) {
+	dir := t.TempDir()
+	archive, err := aggregation.NewLedgerArchive(dir)
+	require.NoError(t, err)
+
+	for seq := uint32(63990); seq <= 64010; seq++ {
+		require.NoError(t, archive.Write(testLedgerCloseMeta(seq)))
+	}
+
+	backend, err := aggregation.NewFileLedgerBackend(dir, aggregation.ArchiveSchema)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, backend.PrepareRange(ctx, backends.BoundedRange(63990, 64010)))
+	for seq := uint32(63990); seq <= 64010; seq++ {
+		lcm, err := backend.GetLedger(ctx, seq)
+		require.NoError(t, err)
+		require.Equal(t, seq, lcm.LedgerSequence())
+	}
+}
@@ -0,0 +1,81 @@
+package aggregation
+
+import (
+	"github.com/decentrio/soro-book/config"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// ContractFilter decides which contract records are persisted. A record
+// passes when its contract is allowed and, if accounts are configured, when
+// one of the accounts it is tied to is listed. Records that are not tied to
+// an account are only filtered by contract.
+type ContractFilter struct {
+	contracts        map[string]struct{}
+	excludeContracts map[string]struct{}
+	accounts         map[string]struct{}
+}
+
+func NewContractFilter(cfg config.FilterConfig) *ContractFilter {
+	return &ContractFilter{
+		contracts:        toSet(cfg.Contracts),
+		excludeContracts: toSet(cfg.ExcludeContracts),
+		accounts:         toSet(cfg.Accounts),
+	}
+}
+
+// Allow reports whether a record of contractId tied to accounts is persisted.
+func (f *ContractFilter) Allow(contractId string, accounts ...string) bool {
+	if f == nil {
+		return true
+	}
+
+	if _, found := f.excludeContracts[contractId]; found {
+		return false
+	}
+	if len(f.contracts) > 0 {
+		if _, found := f.contracts[contractId]; !found {
+			return false
+		}
+	}
+
+	if len(f.accounts) == 0 || len(accounts) == 0 {
+		return true
+	}
+	for _, account := range accounts {
+		if _, found := f.accounts[account]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowAssetContractEvent filters a stellar asset contract event by its
+// contract and the addresses it moves balances between.
+func (f *ContractFilter) AllowAssetContractEvent(event models.StellarAssetContractEvent) bool {
+	switch e := event.(type) {
+	case *models.AssetContractTransferEvent:
+		return f.Allow(e.ContractId, e.FromAddr, e.ToAddr)
+	case *models.AssetContractMintEvent:
+		return f.Allow(e.ContractId, e.AdminAddr, e.ToAddr)
+	case *models.AssetContractClawbackEvent:
+		return f.Allow(e.ContractId, e.AdminAddr, e.FromAddr)
+	case *models.AssetContractBurnEvent:
+		return f.Allow(e.ContractId, e.FromAddr)
+	default:
+		return true
+	}
+}
+
+// active reports whether the filter drops any record
+func (f *ContractFilter) active() bool {
+	return f != nil && len(f.contracts)+len(f.excludeContracts)+len(f.accounts) > 0
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
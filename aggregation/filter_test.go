@@ -0,0 +1,39 @@
+package aggregation_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/config"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+func TestContractFilter(t *testing.T) {
+	var nilFilter *aggregation.ContractFilter
+	require.True(t, nilFilter.Allow("C1", "G1"))
+
+	filter := aggregation.NewContractFilter(config.FilterConfig{})
+	require.True(t, filter.Allow("C1", "G1"))
+
+	filter = aggregation.NewContractFilter(config.FilterConfig{
+		Contracts:        []string{"C1", "C2"},
+		ExcludeContracts: []string{"C2"},
+	})
+	require.True(t, filter.Allow("C1"))
+	require.False(t, filter.Allow("C2"))
+	require.False(t, filter.Allow("C3"))
+
+	filter = aggregation.NewContractFilter(config.FilterConfig{
+		Contracts: []string{"C1"},
+		Accounts:  []string{"G1"},
+	})
+	require.True(t, filter.Allow("C1"))
+	require.True(t, filter.Allow("C1", "G2", "G1"))
+	require.False(t, filter.Allow("C1", "G2"))
+	require.False(t, filter.Allow("C3", "G1"))
+
+	require.True(t, filter.AllowAssetContractEvent(&models.AssetContractTransferEvent{ContractId: "C1", FromAddr: "G2", ToAddr: "G1"}))
+	require.False(t, filter.AllowAssetContractEvent(&models.AssetContractMintEvent{ContractId: "C1", AdminAddr: "G2", ToAddr: "G3"}))
+}
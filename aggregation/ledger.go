@@ -3,7 +3,7 @@ package aggregation
 import (
 	"fmt"
 	"io"
-	"time"
+	"sort"
 
 	"github.com/decentrio/soro-book/database/models"
 	"github.com/stellar/go/ingest"
@@ -11,68 +11,145 @@ import (
 	"github.com/stellar/go/xdr"
 )
 
-type LedgerWrapper struct {
-	ledger models.Ledger
-	txs    []TransactionWrapper
+// LedgerBundle holds the records decoded from one ledger, its transactions
+// are in application order
+type LedgerBundle struct {
+	Ledger       models.Ledger
+	Transactions []TransactionBundle
+
+	err error
 }
 
-func (as *Aggregation) getNewLedger() {
-	// prepare range
-	from, to := as.prepare()
+// getNewLedger fetches the next ledgers and reports whether it made
+// progress. A failed fetch is tried again from the same ledger, the range is
+// prepared again first.
+func (as *Aggregation) getNewLedger() (bool, error) {
+	if as.EndLedgerSeq != 0 {
+		return as.getBoundedLedger()
+	}
+
 	// get ledger
 	if !as.isSync {
+		// prepare range
+		from, to, err := as.prepare()
+		if err != nil {
+			return false, err
+		}
 		for seq := from; seq < to; seq++ {
 			ledgerCloseMeta, err := as.backend.GetLedger(as.ctx, seq)
 			if err != nil {
-				as.Logger.Error(fmt.Sprintf("error get ledger %s", err.Error()))
-				return
+				as.isSync = false
+				return false, fmt.Errorf("error get ledger %d: %w", seq, err)
 			}
 
-			go func(l xdr.LedgerCloseMeta) {
-				as.ledgerQueue <- l
-			}(ledgerCloseMeta)
+			if !as.queueLedger(ledgerCloseMeta) {
+				return false, nil
+			}
+			as.StartLedgerSeq = seq + 1
 		}
 	} else {
 		seq := as.StartLedgerSeq
 		ledgerCloseMeta, err := as.backend.GetLedger(as.ctx, seq)
 		if err != nil {
-			as.Logger.Error(fmt.Sprintf("error get ledger %s", err.Error()))
-			return
+			as.isSync = false
+			return false, fmt.Errorf("error get ledger %d: %w", seq, err)
 		}
 
-		go func(l xdr.LedgerCloseMeta) {
-			as.ledgerQueue <- l
-		}(ledgerCloseMeta)
+		if !as.queueLedger(ledgerCloseMeta) {
+			return false, nil
+		}
 		as.StartLedgerSeq++
 	}
+
+	return true, nil
 }
 
-// aggregation process
+// getBoundedLedger fetches the next ledger of the closed range
+// [StartLedgerSeq, EndLedgerSeq] and finishes the run after the last one.
+func (as *Aggregation) getBoundedLedger() (bool, error) {
+	if as.StartLedgerSeq > as.EndLedgerSeq {
+		as.finish(nil)
+		return true, nil
+	}
+
+	if !as.isSync {
+		ledgerRange := backends.BoundedRange(as.StartLedgerSeq, as.EndLedgerSeq)
+		err := as.backend.PrepareRange(as.ctx, ledgerRange)
+		if err != nil {
+			return false, fmt.Errorf("error prepare %s: %w", ledgerRange.String(), err)
+		}
+		as.isSync = true
+	}
+
+	ledgerCloseMeta, err := as.backend.GetLedger(as.ctx, as.StartLedgerSeq)
+	if err != nil {
+		as.isSync = false
+		return false, fmt.Errorf("error get ledger %d: %w", as.StartLedgerSeq, err)
+	}
+
+	if !as.queueLedger(ledgerCloseMeta) {
+		return false, nil
+	}
+	as.StartLedgerSeq++
+	return true, nil
+}
+
+// queueLedger hands a ledger to the decode workers. Ledgers must be queued
+// in sequence order, it blocks while too many ledgers are not committed yet
+// and returns false if the service is stopped meanwhile.
+func (as *Aggregation) queueLedger(l xdr.LedgerCloseMeta) bool {
+	select {
+	case as.inFlight <- struct{}{}:
+	case <-as.BaseService.Terminate():
+		return false
+	}
+
+	as.pending.Add(1)
+	// never blocks, ledgerQueue has room for every ledger in flight
+	as.ledgerQueue <- l
+	return true
+}
+
+// ledgerProcessing is a decode worker, ledgers are decoded in parallel and
+// handed to the committer in any order. It keeps decoding after terminate
+// until the queue is drained.
 func (as *Aggregation) ledgerProcessing() {
 	for {
 		select {
-		// Receive a new tx
 		case ledger := <-as.ledgerQueue:
-			as.handleReceiveNewLedger(ledger)
-		// Terminate process
-		case <-as.BaseService.Terminate():
+			as.bundleQueue <- as.decodeLedger(ledger)
+		case <-as.quit:
 			return
-		default:
 		}
-		time.Sleep(time.Millisecond)
 	}
 }
 
-// handleReceiveTx
-func (as *Aggregation) handleReceiveNewLedger(l xdr.LedgerCloseMeta) {
-	ledger := getLedgerFromCloseMeta(l)
+// decodeLedger archives a ledger and decodes its records.
+func (as *Aggregation) decodeLedger(l xdr.LedgerCloseMeta) *LedgerBundle {
+	b := &LedgerBundle{
+		Ledger: models.Ledger{Seq: l.LedgerSequence()},
+	}
+
+	if as.archive != nil {
+		if err := as.archive.Write(l); err != nil {
+			as.Logger.Error(fmt.Sprintf("Error archive ledger %d: %s", l.LedgerSequence(), err.Error()))
+		}
+	}
+
+	ledger, err := getLedgerFromCloseMeta(l)
+	if err != nil {
+		b.err = &DecodeError{Ledger: b.Ledger.Seq, Err: err}
+		return b
+	}
 
 	var txWrappers []TransactionWrapper
-	transactions := uint32(0)
 	operations := uint32(0)
 	// get tx
 	txReader, err := ingest.NewLedgerTransactionReaderFromLedgerCloseMeta(as.Cfg.NetworkPassphrase, l)
-	panicIf(err)
+	if err != nil {
+		b.err = &DecodeError{Ledger: b.Ledger.Seq, Err: err}
+		return b
+	}
 	defer txReader.Close()
 
 	// Read each transaction within the ledger, extract its operations, and
@@ -82,40 +159,57 @@ func (as *Aggregation) handleReceiveNewLedger(l xdr.LedgerCloseMeta) {
 		if err == io.EOF {
 			break
 		}
-
 		if err != nil {
-			as.Logger.Error(fmt.Sprintf("error txReader %s", err.Error()))
+			b.err = &DecodeError{Ledger: b.Ledger.Seq, Err: fmt.Errorf("error txReader %w", err)}
+			return b
 		}
 
 		txWrapper := NewTransactionWrapper(tx, ledger.Seq, ledger.LedgerTime)
 		txWrappers = append(txWrappers, txWrapper)
 
 		operations += uint32(len(tx.Envelope.Operations()))
-		transactions++
 	}
 
-	ledger.Transactions = transactions
-	ledger.Operations = operations
+	sort.Slice(txWrappers, func(i, j int) bool {
+		return txWrappers[i].GetApplicationOrder() < txWrappers[j].GetApplicationOrder()
+	})
 
-	// Create Ledger
-	_, err = as.db.CreateLedger(&ledger)
-	if err != nil {
-		as.Logger.Error(fmt.Sprintf("Error create ledger %d: %s", ledger.Seq, err.Error()))
+	if !as.ACfg.SkipVerify {
+		if err := verifyCloseMeta(l, txWrappers); err != nil {
+			b.err = &VerifyError{Ledger: b.Ledger.Seq, Err: err}
+			return b
+		}
 	}
 
-	// Create Tx and Soroban events
+	ledger.Transactions = uint32(len(txWrappers))
+	ledger.Operations = operations
+	b.Ledger = ledger
+
 	for _, tw := range txWrappers {
-		go func(twi TransactionWrapper) {
-			as.txQueue <- twi
-		}(tw)
+		tb, err := NewTransactionBundle(tw, as.filter)
+		if err != nil {
+			b.err = &DecodeError{Ledger: b.Ledger.Seq, TxHash: tw.GetTransactionHash(), Err: err}
+			return b
+		}
+		b.Transactions = append(b.Transactions, tb)
 	}
+
+	return b
 }
 
-func (as *Aggregation) prepare() (uint32, uint32) {
+// prepare prepares the backend for the next ledgers and returns the range
+// [from, to) to fetch before preparing again.
+func (as *Aggregation) prepare() (uint32, uint32, error) {
 	if !as.isSync {
 		from := as.StartLedgerSeq
 		to := from + DefaultPrepareStep
 
+		// the tip keeps moving while catching up, refresh it before
+		// switching to an unbounded range
+		if to > as.CurrLedgerSeq {
+			as.updateTip()
+		}
+
 		var ledgerRange backends.Range
 		if to > as.CurrLedgerSeq {
 			ledgerRange = backends.UnboundedRange(from)
@@ -123,32 +217,45 @@ func (as *Aggregation) prepare() (uint32, uint32) {
 			ledgerRange = backends.BoundedRange(from, to)
 		}
 
-		fmt.Println(ledgerRange)
+		as.Logger.Debugf("prepare %s", ledgerRange.String())
 		err := as.backend.PrepareRange(as.ctx, ledgerRange)
 		if err != nil {
-			as.Logger.Errorf("error prepare %s", err.Error())
-			return 0, 0 // if prepare error, we should skip here
-		} else {
-			if to > as.CurrLedgerSeq {
-				as.isSync = true
-			}
+			return 0, 0, fmt.Errorf("error prepare %s: %w", ledgerRange.String(), err)
 		}
-		as.StartLedgerSeq += DefaultPrepareStep
-		return from, to
+		if to > as.CurrLedgerSeq {
+			as.isSync = true
+		}
+		return from, to, nil
 	}
 
-	return 0, 0
+	return 0, 0, nil
 }
 
-func getLedgerFromCloseMeta(ledgerCloseMeta xdr.LedgerCloseMeta) models.Ledger {
-	var ledgerHeader xdr.LedgerHeaderHistoryEntry
+// updateTip sets CurrLedgerSeq to the latest ledger of the network.
+func (as *Aggregation) updateTip() {
+	latestLedger, err := GetLatestLedger(as.ctx, as.ACfg.RPCURL, as.Cfg.HistoryArchiveURLs)
+	if err != nil {
+		as.Logger.Errorf("error get latest ledger %s", err.Error())
+		return
+	}
+	as.CurrLedgerSeq = latestLedger
+}
+
+func getLedgerHeaderFromCloseMeta(ledgerCloseMeta xdr.LedgerCloseMeta) (xdr.LedgerHeaderHistoryEntry, error) {
 	switch ledgerCloseMeta.V {
 	case 0:
-		ledgerHeader = ledgerCloseMeta.MustV0().LedgerHeader
+		return ledgerCloseMeta.MustV0().LedgerHeader, nil
 	case 1:
-		ledgerHeader = ledgerCloseMeta.MustV1().LedgerHeader
+		return ledgerCloseMeta.MustV1().LedgerHeader, nil
 	default:
-		panic(fmt.Sprintf("Unsupported LedgerCloseMeta.V: %d", ledgerCloseMeta.V))
+		return xdr.LedgerHeaderHistoryEntry{}, fmt.Errorf("unsupported LedgerCloseMeta.V: %d", ledgerCloseMeta.V)
+	}
+}
+
+func getLedgerFromCloseMeta(ledgerCloseMeta xdr.LedgerCloseMeta) (models.Ledger, error) {
+	ledgerHeader, err := getLedgerHeaderFromCloseMeta(ledgerCloseMeta)
+	if err != nil {
+		return models.Ledger{}, err
 	}
 
 	timeStamp := uint64(ledgerHeader.Header.ScpValue.CloseTime)
@@ -158,5 +265,5 @@ func getLedgerFromCloseMeta(ledgerCloseMeta xdr.LedgerCloseMeta) models.Ledger {
 		PrevHash:   ledgerCloseMeta.PreviousLedgerHash().HexString(),
 		Seq:        ledgerCloseMeta.LedgerSequence(),
 		LedgerTime: timeStamp,
-	}
+	}, nil
 }
@@ -0,0 +1,160 @@
+package aggregation
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+
+	db "github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// ReindexStats counts the records rebuilt by Reindex
+type ReindexStats struct {
+	Transactions       uint64
+	InvokeTransactions uint64
+	CreatedContracts   uint64
+	ContractsData      uint64
+	Events             uint64
+}
+
+// NewTransactionWrapperFromModel rebuilds a TransactionWrapper from the XDR
+// stored with a transaction.
+func NewTransactionWrapperFromModel(tx models.Transaction) (TransactionWrapper, error) {
+	var envelope xdr.TransactionEnvelope
+	if err := envelope.UnmarshalBinary(tx.EnvelopeXdr); err != nil {
+		return TransactionWrapper{}, fmt.Errorf("error decode envelope of tx %s: %w", tx.Hash, err)
+	}
+
+	var result xdr.TransactionResultPair
+	if err := result.UnmarshalBinary(tx.ResultXdr); err != nil {
+		return TransactionWrapper{}, fmt.Errorf("error decode result of tx %s: %w", tx.Hash, err)
+	}
+
+	var resultMeta xdr.TransactionResultMeta
+	if err := resultMeta.UnmarshalBinary(tx.ResultMetaXdr); err != nil {
+		return TransactionWrapper{}, fmt.Errorf("error decode result meta of tx %s: %w", tx.Hash, err)
+	}
+
+	ledgerTx := ingest.LedgerTransaction{
+		Index:      tx.ApplicationOrder,
+		Envelope:   envelope,
+		Result:     result,
+		FeeChanges: resultMeta.FeeProcessing,
+		UnsafeMeta: resultMeta.TxApplyProcessing,
+	}
+
+	return NewTransactionWrapper(ledgerTx, tx.Ledger, tx.TransactionTime), nil
+}
+
+// ReindexChunkSize is the number of ledgers Reindex rebuilds in one
+// database transaction.
+const ReindexChunkSize = 64
+
+// Reindex rebuilds the invocations, created contracts, contract data entries
+// and contract events of ledgers [from, to] from the transactions stored in
+// the database, keeping only the records allowed by filter. The range is
+// rewritten in chunks of ReindexChunkSize ledgers, each in its own database
+// transaction, so a failed reindex leaves the records of the failed chunk
+// and the ones after it in place.
+func Reindex(h *db.DBHandler, from, to uint32, filter *ContractFilter) (ReindexStats, error) {
+	var stats ReindexStats
+
+	for start := from; start <= to; start += ReindexChunkSize {
+		end := start + ReindexChunkSize - 1
+		if end > to || end < start {
+			end = to
+		}
+
+		chunkStats, err := reindexChunk(h, start, end, filter)
+		if err != nil {
+			return stats, fmt.Errorf("error reindex [%d, %d]: %w", start, end, err)
+		}
+
+		stats.Transactions += chunkStats.Transactions
+		stats.InvokeTransactions += chunkStats.InvokeTransactions
+		stats.CreatedContracts += chunkStats.CreatedContracts
+		stats.ContractsData += chunkStats.ContractsData
+		stats.Events += chunkStats.Events
+
+		if end == to {
+			break
+		}
+	}
+
+	return stats, nil
+}
+
+func reindexChunk(h *db.DBHandler, from, to uint32, filter *ContractFilter) (ReindexStats, error) {
+	var stats ReindexStats
+
+	txs, err := h.GetTransactions(from, to)
+	if err != nil {
+		return stats, err
+	}
+
+	err = h.Transaction(func(h *db.DBHandler) error {
+		// keys of the deleted entries, whose newest entry may change
+		if err := h.StageContractDataKeys(from, to); err != nil {
+			return err
+		}
+		if err := h.DeleteDerivedData(from, to); err != nil {
+			return err
+		}
+
+		for _, tx := range txs {
+			tw, err := NewTransactionWrapperFromModel(tx)
+			if err != nil {
+				return err
+			}
+
+			if err := reindexTransaction(h, tw, filter, &stats); err != nil {
+				return fmt.Errorf("error reindex ledger %d tx %s: %w", tx.Ledger, tx.Hash, err)
+			}
+			stats.Transactions++
+		}
+
+		return h.RecomputeStagedContractData(from, to)
+	})
+
+	return stats, err
+}
+
+func reindexTransaction(h *db.DBHandler, tw TransactionWrapper, filter *ContractFilter, stats *ReindexStats) error {
+	b, err := NewTransactionBundle(tw, filter)
+	if err != nil {
+		return err
+	}
+
+	if err := writeTransactionRecords(h, b); err != nil {
+		return err
+	}
+
+	stats.InvokeTransactions += uint64(len(b.InvokeTransactions))
+	stats.CreatedContracts += uint64(len(b.CreatedContracts))
+	stats.ContractsData += uint64(len(b.ContractsData))
+	stats.Events += uint64(len(b.AssetEvents) + len(b.WasmEvents))
+
+	return nil
+}
+
+// createAssetContractEvent stores a stellar asset contract event in the
+// table of its type.
+func createAssetContractEvent(h *db.DBHandler, event models.StellarAssetContractEvent) error {
+	var err error
+	switch e := event.(type) {
+	case *models.AssetContractTransferEvent:
+		_, err = h.CreateAssetContractTransferEvent(e)
+	case *models.AssetContractMintEvent:
+		_, err = h.CreateAssetContractMintEvent(e)
+	case *models.AssetContractClawbackEvent:
+		_, err = h.CreateAssetContractClawbackEvent(e)
+	case *models.AssetContractBurnEvent:
+		_, err = h.CreateAssetContractBurnEvent(e)
+	default:
+		err = fmt.Errorf("event type ('%s') unsupported", event.GetType())
+	}
+
+	return err
+}
@@ -0,0 +1,197 @@
+package aggregation_test
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/config"
+	db "github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// testLedgerBase keeps the test ledgers away from real ones
+const testLedgerBase = 2_000_000_000
+
+var errRollback = errors.New("rollback")
+
+// testInvokeTransaction returns a successful transaction of ledger invoking
+// fn on contract, whose meta writes the "key" contract data entry of the
+// contract with changeType.
+func testInvokeTransaction(t *testing.T, ledger uint32, contract xdr.Hash, fn string, changeType xdr.LedgerEntryChangeType) *models.Transaction {
+	address := xdr.ScAddress{
+		Type:       xdr.ScAddressTypeScAddressTypeContract,
+		ContractId: &contract,
+	}
+
+	envelope := xdr.TransactionEnvelope{
+		Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+		V1: &xdr.TransactionV1Envelope{
+			Tx: xdr.Transaction{
+				SourceAccount: xdr.MustMuxedAddress(keypair.MustRandom().Address()),
+				Operations: []xdr.Operation{{
+					Body: xdr.OperationBody{
+						Type: xdr.OperationTypeInvokeHostFunction,
+						InvokeHostFunctionOp: &xdr.InvokeHostFunctionOp{
+							HostFunction: xdr.HostFunction{
+								Type: xdr.HostFunctionTypeHostFunctionTypeInvokeContract,
+								InvokeContract: &xdr.InvokeContractArgs{
+									ContractAddress: address,
+									FunctionName:    xdr.ScSymbol(fn),
+								},
+							},
+						},
+					},
+				}},
+			},
+		},
+	}
+
+	key := xdr.ScSymbol("key")
+	value := xdr.Uint32(ledger)
+	entry := &xdr.LedgerEntry{
+		LastModifiedLedgerSeq: xdr.Uint32(ledger),
+		Data: xdr.LedgerEntryData{
+			Type: xdr.LedgerEntryTypeContractData,
+			ContractData: &xdr.ContractDataEntry{
+				Contract:   address,
+				Key:        xdr.ScVal{Type: xdr.ScValTypeScvSymbol, Sym: &key},
+				Durability: xdr.ContractDataDurabilityPersistent,
+				Val:        xdr.ScVal{Type: xdr.ScValTypeScvU32, U32: &value},
+			},
+		},
+	}
+	change := xdr.LedgerEntryChange{Type: changeType}
+	switch changeType {
+	case xdr.LedgerEntryChangeTypeLedgerEntryCreated:
+		change.Created = entry
+	case xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
+		change.Updated = entry
+	default:
+		t.Fatalf("unsupported change type %s", changeType)
+	}
+
+	tx := ingest.LedgerTransaction{
+		Index:    1,
+		Envelope: envelope,
+		Result: xdr.TransactionResultPair{
+			TransactionHash: sha256.Sum256(fmt.Appendf(nil, "%d/%x/%s", ledger, contract, fn)),
+			Result: xdr.TransactionResult{
+				Result: xdr.TransactionResultResult{
+					Code:    xdr.TransactionResultCodeTxSuccess,
+					Results: &[]xdr.OperationResult{},
+				},
+			},
+		},
+		UnsafeMeta: xdr.TransactionMeta{
+			V: 3,
+			V3: &xdr.TransactionMetaV3{
+				Operations: []xdr.OperationMeta{{Changes: xdr.LedgerEntryChanges{change}}},
+			},
+		},
+	}
+
+	return aggregation.NewTransactionWrapper(tx, ledger, 0).GetModelsTransaction()
+}
+
+func storeTransaction(t *testing.T, h *db.DBHandler, tx *models.Transaction) {
+	_, err := h.CreateLedger(&models.Ledger{Seq: tx.Ledger})
+	require.NoError(t, err)
+	_, err = h.CreateTransaction(tx)
+	require.NoError(t, err)
+}
+
+func TestReindex(t *testing.T) {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	h := db.NewDBHandler()
+
+	contract := xdr.Hash(sha256.Sum256([]byte("reindex")))
+	contractId, err := strkey.Encode(strkey.VersionByteContract, contract[:])
+	require.NoError(t, err)
+
+	// a contract whose entry was seeded from a checkpoint, no stored
+	// transaction wrote it
+	seeded := xdr.Hash(sha256.Sum256([]byte("reindex checkpoint")))
+	seededId, err := strkey.Encode(strkey.VersionByteContract, seeded[:])
+	require.NoError(t, err)
+
+	base := uint32(testLedgerBase)
+	// both ledgers land in different chunks
+	created := base + 1
+	updated := base + 1 + aggregation.ReindexChunkSize
+	checkpoint := models.ContractsData{
+		Id:            aggregation.ContractDataId(created, "", seededId, "", []byte("key")),
+		ContractId:    seededId,
+		Ledger:        created,
+		EntryType:     aggregation.EntryTypeCheckpoint,
+		KeyXdr:        []byte("key"),
+		ValueXdr:      []byte("value"),
+		IsNewest:      true,
+		UpdatedLedger: math.MaxInt32,
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter config.FilterConfig
+		newest []bool
+	}{
+		{"no filter", config.FilterConfig{}, []bool{false, true}},
+		{"allowed contract", config.FilterConfig{Contracts: []string{contractId}}, []bool{false, true}},
+		{"excluded contract", config.FilterConfig{ExcludeContracts: []string{contractId}}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := h.Transaction(func(h *db.DBHandler) error {
+				storeTransaction(t, h, testInvokeTransaction(t, created, contract, "set", xdr.LedgerEntryChangeTypeLedgerEntryCreated))
+				storeTransaction(t, h, testInvokeTransaction(t, updated, contract, "set", xdr.LedgerEntryChangeTypeLedgerEntryUpdated))
+				require.NoError(t, h.CreateContractsDataBatch([]models.ContractsData{checkpoint}))
+
+				stats, err := aggregation.Reindex(h, created, updated, aggregation.NewContractFilter(tc.filter))
+				require.NoError(t, err)
+				require.Equal(t, uint64(2), stats.Transactions)
+				require.Equal(t, uint64(len(tc.newest)), stats.ContractsData)
+
+				entries, err := h.GetContractData(contractId)
+				require.NoError(t, err)
+				require.Len(t, entries, len(tc.newest))
+				for i, entry := range entries {
+					require.Equal(t, tc.newest[i], entry.IsNewest)
+				}
+				if len(entries) == 2 {
+					require.Equal(t, created, entries[0].Ledger)
+					require.Equal(t, updated-1, entries[0].UpdatedLedger)
+					require.Equal(t, updated, entries[1].Ledger)
+				}
+
+				// reindexing the range again rebuilds the same entries
+				_, err = aggregation.Reindex(h, created, updated, aggregation.NewContractFilter(tc.filter))
+				require.NoError(t, err)
+				again, err := h.GetContractData(contractId)
+				require.NoError(t, err)
+				require.Equal(t, entries, again)
+
+				// the checkpoint entry is not derived from the range
+				seededEntries, err := h.GetContractData(seededId)
+				require.NoError(t, err)
+				require.Len(t, seededEntries, 1)
+				require.Equal(t, aggregation.EntryTypeCheckpoint, seededEntries[0].EntryType)
+				require.Equal(t, created, seededEntries[0].Ledger)
+				require.True(t, seededEntries[0].IsNewest)
+
+				return errRollback
+			})
+			require.ErrorIs(t, err, errRollback)
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package aggregation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	DefaultRPCBatchSize    = uint32(200)
+	DefaultRPCPollInterval = time.Second
+	DefaultRPCTimeout      = 30 * time.Second
+)
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// rpcCall sends a JSON-RPC request to a Stellar RPC server and decodes its
+// result into result.
+func rpcCall(ctx context.Context, client *http.Client, url string, method string, params interface{}, result interface{}) error {
+	requestBody, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      8675309,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc %s: unexpected status %s", method, response.Status)
+	}
+
+	var responseData rpcResponse
+	if err := json.NewDecoder(response.Body).Decode(&responseData); err != nil {
+		return err
+	}
+	if responseData.Error != nil {
+		return responseData.Error
+	}
+
+	return json.Unmarshal(responseData.Result, result)
+}
+
+type rpcGetLedgersRequest struct {
+	StartLedger uint32            `json:"startLedger"`
+	Pagination  rpcPaginationArgs `json:"pagination"`
+	XdrFormat   string            `json:"xdrFormat,omitempty"`
+}
+
+type rpcPaginationArgs struct {
+	Limit uint32 `json:"limit"`
+}
+
+type rpcLedgerInfo struct {
+	Hash        string `json:"hash"`
+	Sequence    uint32 `json:"sequence"`
+	MetadataXdr string `json:"metadataXdr"`
+}
+
+type rpcGetLedgersResponse struct {
+	Ledgers      []rpcLedgerInfo `json:"ledgers"`
+	LatestLedger uint32          `json:"latestLedger"`
+	OldestLedger uint32          `json:"oldestLedger"`
+	Cursor       string          `json:"cursor"`
+}
+
+type rpcGetLatestLedgerResponse struct {
+	ID              string `json:"id"`
+	ProtocolVersion uint32 `json:"protocolVersion"`
+	Sequence        uint32 `json:"sequence"`
+}
+
+// RPCLedgerBackend is a ledger backend that reads LedgerCloseMeta from the
+// getLedgers method of a Stellar RPC server. It only covers the retention
+// window of the server, so it is meant for following the tip.
+type RPCLedgerBackend struct {
+	url          string
+	client       *http.Client
+	batchSize    uint32
+	pollInterval time.Duration
+
+	ledgerRange backends.Range
+	prepared    bool
+
+	// buffer holds ledgers fetched ahead of the current sequence
+	buffer map[uint32]xdr.LedgerCloseMeta
+}
+
+var _ backends.LedgerBackend = (*RPCLedgerBackend)(nil)
+
+func NewRPCLedgerBackend(url string) (*RPCLedgerBackend, error) {
+	if url == "" {
+		return nil, fmt.Errorf("rpc url is not set")
+	}
+
+	return &RPCLedgerBackend{
+		url:          url,
+		client:       &http.Client{Timeout: DefaultRPCTimeout},
+		batchSize:    DefaultRPCBatchSize,
+		pollInterval: DefaultRPCPollInterval,
+		buffer:       make(map[uint32]xdr.LedgerCloseMeta),
+	}, nil
+}
+
+func (b *RPCLedgerBackend) GetLatestLedgerSequence(ctx context.Context) (uint32, error) {
+	var result rpcGetLatestLedgerResponse
+	if err := rpcCall(ctx, b.client, b.url, "getLatestLedger", nil, &result); err != nil {
+		return 0, err
+	}
+
+	return result.Sequence, nil
+}
+
+func (b *RPCLedgerBackend) PrepareRange(ctx context.Context, ledgerRange backends.Range) error {
+	if ledgerRange.Bounded() {
+		latest, err := b.GetLatestLedgerSequence(ctx)
+		if err != nil {
+			return fmt.Errorf("error prepare range %s: %w", ledgerRange.String(), err)
+		}
+		if ledgerRange.To() > latest {
+			return fmt.Errorf("ledger %d is after the latest rpc ledger %d", ledgerRange.To(), latest)
+		}
+	}
+
+	b.ledgerRange = ledgerRange
+	b.prepared = true
+	b.buffer = make(map[uint32]xdr.LedgerCloseMeta)
+	return nil
+}
+
+func (b *RPCLedgerBackend) IsPrepared(ctx context.Context, ledgerRange backends.Range) (bool, error) {
+	if !b.prepared {
+		return false, nil
+	}
+
+	return b.ledgerRange.Contains(ledgerRange), nil
+}
+
+// GetLedger returns the ledger with the given sequence. In an unbounded range
+// it waits for the RPC server to close the ledger.
+func (b *RPCLedgerBackend) GetLedger(ctx context.Context, seq uint32) (xdr.LedgerCloseMeta, error) {
+	if !b.prepared {
+		return xdr.LedgerCloseMeta{}, fmt.Errorf("session is not prepared, call PrepareRange first")
+	}
+	if seq < b.ledgerRange.From() || (b.ledgerRange.Bounded() && seq > b.ledgerRange.To()) {
+		return xdr.LedgerCloseMeta{}, fmt.Errorf("ledger %d is outside of the prepared range %s", seq, b.ledgerRange.String())
+	}
+
+	for {
+		if lcm, found := b.buffer[seq]; found {
+			delete(b.buffer, seq)
+			return lcm, nil
+		}
+
+		latest, err := b.fetch(ctx, seq)
+		if err != nil {
+			return xdr.LedgerCloseMeta{}, err
+		}
+		if _, found := b.buffer[seq]; found {
+			continue
+		}
+		if b.ledgerRange.Bounded() || seq <= latest {
+			return xdr.LedgerCloseMeta{}, fmt.Errorf("ledger %d not returned by rpc", seq)
+		}
+
+		select {
+		case <-ctx.Done():
+			return xdr.LedgerCloseMeta{}, ctx.Err()
+		case <-time.After(b.pollInterval):
+		}
+	}
+}
+
+func (b *RPCLedgerBackend) Close() error {
+	b.prepared = false
+	b.buffer = make(map[uint32]xdr.LedgerCloseMeta)
+	return nil
+}
+
+// fetch loads a page of ledgers starting at seq into the buffer and returns
+// the latest ledger known by the server.
+func (b *RPCLedgerBackend) fetch(ctx context.Context, seq uint32) (uint32, error) {
+	latest, err := b.GetLatestLedgerSequence(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if seq > latest {
+		return latest, nil
+	}
+
+	limit := b.batchSize
+	if b.ledgerRange.Bounded() && b.ledgerRange.To()-seq+1 < limit {
+		limit = b.ledgerRange.To() - seq + 1
+	}
+
+	var result rpcGetLedgersResponse
+	err = rpcCall(ctx, b.client, b.url, "getLedgers", rpcGetLedgersRequest{
+		StartLedger: seq,
+		Pagination:  rpcPaginationArgs{Limit: limit},
+		XdrFormat:   "base64",
+	}, &result)
+	if err != nil {
+		return 0, err
+	}
+
+	// drop what was left from a previous page
+	b.buffer = make(map[uint32]xdr.LedgerCloseMeta, len(result.Ledgers))
+	for _, info := range result.Ledgers {
+		var lcm xdr.LedgerCloseMeta
+		if err := xdr.SafeUnmarshalBase64(info.MetadataXdr, &lcm); err != nil {
+			return 0, fmt.Errorf("error decode ledger %d: %w", info.Sequence, err)
+		}
+		b.buffer[info.Sequence] = lcm
+	}
+
+	return result.LatestLedger, nil
+}
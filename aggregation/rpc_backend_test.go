@@ -0,0 +1,141 @@
+package aggregation_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+)
+
+// newTestRPCServer serves getLatestLedger and getLedgers for ledgers
+// [oldest, latest] the way a Stellar RPC server responds.
+func newTestRPCServer(t *testing.T, oldest, latest uint32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params struct {
+				StartLedger uint32 `json:"startLedger"`
+				Pagination  struct {
+					Limit uint32 `json:"limit"`
+				} `json:"pagination"`
+			} `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		var result interface{}
+		switch req.Method {
+		case "getLatestLedger":
+			result = map[string]interface{}{
+				"id":              "test",
+				"protocolVersion": 22,
+				"sequence":        latest,
+			}
+		case "getLedgers":
+			var ledgers []map[string]interface{}
+			for seq := req.Params.StartLedger; seq <= latest && uint32(len(ledgers)) < req.Params.Pagination.Limit; seq++ {
+				metadata, err := xdr.MarshalBase64(testLedgerCloseMeta(seq))
+				require.NoError(t, err)
+				ledgers = append(ledgers, map[string]interface{}{
+					"hash":        "test",
+					"sequence":    seq,
+					"metadataXdr": metadata,
+				})
+			}
+			result = map[string]interface{}{
+				"ledgers":      ledgers,
+				"latestLedger": latest,
+				"oldestLedger": oldest,
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      8675309,
+			"result":  result,
+		}))
+	}))
+}
+
+func TestRPCLedgerBackend(t *testing.T) {
+	server := newTestRPCServer(t, 100, 500)
+	defer server.Close()
+
+	backend, err := aggregation.NewRPCLedgerBackend(server.URL)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	latest, err := backend.GetLatestLedgerSequence(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(500), latest)
+
+	require.Error(t, backend.PrepareRange(ctx, backends.BoundedRange(400, 600)))
+	require.NoError(t, backend.PrepareRange(ctx, backends.BoundedRange(150, 450)))
+
+	for seq := uint32(150); seq <= 450; seq++ {
+		lcm, err := backend.GetLedger(ctx, seq)
+		require.NoError(t, err)
+		require.Equal(t, seq, lcm.LedgerSequence())
+	}
+
+	_, err = backend.GetLedger(ctx, 451)
+	require.Error(t, err)
+}
+
+func TestRPCLedgerBackendWaitsForTip(t *testing.T) {
+	server := newTestRPCServer(t, 100, 500)
+	defer server.Close()
+
+	backend, err := aggregation.NewRPCLedgerBackend(server.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, backend.PrepareRange(ctx, backends.UnboundedRange(500)))
+
+	lcm, err := backend.GetLedger(ctx, 500)
+	require.NoError(t, err)
+	require.Equal(t, uint32(500), lcm.LedgerSequence())
+
+	// ledger 501 is not closed yet, the backend keeps polling until cancelled
+	cancel()
+	_, err = backend.GetLedger(ctx, 501)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGetLatestLedger(t *testing.T) {
+	rpcServer := newTestRPCServer(t, 100, 500)
+	defer rpcServer.Close()
+
+	archive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/.well-known/stellar-history.json", r.URL.Path)
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"version":       1,
+			"currentLedger": 447,
+		}))
+	}))
+	defer archive.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+
+	ctx := context.Background()
+	latest, err := aggregation.GetLatestLedger(ctx, rpcServer.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint32(500), latest)
+
+	latest, err = aggregation.GetLatestLedger(ctx, "", []string{down.URL, archive.URL + "/"})
+	require.NoError(t, err)
+	require.Equal(t, uint32(447), latest)
+
+	_, err = aggregation.GetLatestLedger(ctx, "", []string{down.URL})
+	require.Error(t, err)
+}
@@ -2,7 +2,6 @@ package aggregation
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/decentrio/converter/converter"
 	"github.com/decentrio/soro-book/database/models"
@@ -15,66 +14,67 @@ const (
 	FAILED  = "failed"
 )
 
-func (as *Aggregation) transactionProcessing() {
-	for {
-		select {
-		// Receive a new tx
-		case tx := <-as.txQueue:
-			as.handleReceiveNewTransaction(tx)
-		// Terminate process
-		case <-as.BaseService.Terminate():
-			return
-		default:
-		}
-		time.Sleep(time.Millisecond)
-	}
+// TransactionBundle holds the records decoded from one transaction
+type TransactionBundle struct {
+	Transaction        *models.Transaction
+	InvokeTransactions []models.InvokeTransaction
+	CreatedContracts   []models.ContractsCode
+	ContractsData      []models.ContractsData
+	WasmEvents         []models.WasmContractEvent
+	AssetEvents        []models.StellarAssetContractEvent
 }
 
-func (as *Aggregation) handleReceiveNewTransaction(tw TransactionWrapper) {
-	tx := tw.GetModelsTransaction()
-	_, err := as.db.CreateTransaction(tx)
-	if err != nil {
-		as.Logger.Error(fmt.Sprintf("error create ledger %d tx %s: %s", tw.GetLedgerSequence(), tw.GetTransactionHash(), err.Error()))
+// NewTransactionBundle decodes the records of a transaction, keeping only
+// the contract records that pass filter.
+func NewTransactionBundle(tw TransactionWrapper, filter *ContractFilter) (TransactionBundle, error) {
+	b := TransactionBundle{
+		Transaction: tw.GetModelsTransaction(),
 	}
 
 	// if this is invokeHostFuncTx, we should store the detail
 	invokeHostFuncTx, createContractTx, err := isInvokeHostFunctionTx(tw.Tx, tw.LedgerSequence, tw.Time)
 	if err != nil {
-		as.Logger.Error(fmt.Sprintf("error invoke host function %s", err.Error()))
+		return b, fmt.Errorf("error invoke host function %w", err)
 	}
 
+	sourceAccount := tw.Tx.Envelope.SourceAccount().ToAccountId().Address()
 	for _, ivhft := range invokeHostFuncTx {
-		_, err := as.db.CreateContractInvokedTransaction(&ivhft)
-		if err != nil {
-			as.Logger.Error(fmt.Sprintf("error create invoke host function %s", err.Error()))
+		if filter.Allow(ivhft.ContractId, sourceAccount) {
+			b.InvokeTransactions = append(b.InvokeTransactions, ivhft)
 		}
 	}
 
 	for _, cct := range createContractTx {
-		_, err := as.db.CreateContractCreatedTransaction(&cct)
-		if err != nil {
-			as.Logger.Error(fmt.Sprintf("error create contract created function %s", err.Error()))
+		if filter.Allow(cct.ContractId, cct.CreatorAddress) {
+			b.CreatedContracts = append(b.CreatedContracts, cct)
 		}
 	}
 
 	// Contract entry
-	entries := tw.GetModelsContractDataEntry()
-	for _, entry := range entries {
-		as.contractDataEntrysQueue <- entry
+	for _, entry := range tw.GetModelsContractDataEntry() {
+		if filter.Allow(entry.ContractId, entry.AccountId) {
+			b.ContractsData = append(b.ContractsData, entry)
+		}
 	}
 
 	wasmEvent, assetEvent, err := tw.GetContractEvents()
 	if err != nil {
-		return
+		return b, fmt.Errorf("error contract events %w", err)
 	}
 	// Soroban stellar asset events
 	for _, e := range assetEvent {
-		as.assetContractEventsQueue <- e
+		if filter.AllowAssetContractEvent(e) {
+			b.AssetEvents = append(b.AssetEvents, e)
+		}
 	}
 	// Soroban wasm contract events
 	for _, e := range wasmEvent {
-		as.wasmContractEventsQueue <- e
+		if filter.Allow(e.ContractId) {
+			b.WasmEvents = append(b.WasmEvents, e)
+		}
 	}
+
+	return b, nil
 }
 
 func isInvokeHostFunctionTx(tx ingest.LedgerTransaction, ledgerSeq uint32, timeStamp uint64) ([]models.InvokeTransaction, []models.ContractsCode, error) {
@@ -1,52 +1,82 @@
 package aggregation
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
-	backends "github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/support/storage"
 )
 
-func GetLatestLedger(config backends.CaptiveCoreConfig) (uint32, error) {
-	requestData := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      8675309,
-		"method":  "getLatestLedger",
-	}
+// rootHASPath is where a history archive publishes its latest state
+const rootHASPath = ".well-known/stellar-history.json"
 
-	requestBody, err := json.Marshal(requestData)
-	if err != nil {
-		fmt.Println("Error converting JSON data:", err)
-		return 0, err
+// GetLatestLedger returns the tip of the network. It asks the RPC server
+// when rpcURL is set, otherwise it reads the root history archive state of
+// the first history archive that answers, which lags the network by at
+// most one checkpoint.
+func GetLatestLedger(ctx context.Context, rpcURL string, historyArchiveURLs []string) (uint32, error) {
+	client := &http.Client{Timeout: DefaultRPCTimeout}
+
+	if rpcURL != "" {
+		var result rpcGetLatestLedgerResponse
+		if err := rpcCall(ctx, client, rpcURL, "getLatestLedger", nil, &result); err != nil {
+			return 0, err
+		}
+		return result.Sequence, nil
 	}
 
-	if config.NetworkPassphrase != "Test SDF Network ; September 2015" {
-		// todo: mainnet
-		return rpcGetLatestLedger("", requestBody)
+	var errs []string
+	for _, archiveURL := range historyArchiveURLs {
+		latestLedger, err := archiveGetLatestLedger(ctx, client, archiveURL)
+		if err == nil {
+			return latestLedger, nil
+		}
+		errs = append(errs, err.Error())
 	}
 
-	url := "https://soroban-testnet.stellar.org"
-	return rpcGetLatestLedger(url, requestBody)
+	return 0, fmt.Errorf("error get latest ledger from history archives: %s", strings.Join(errs, "; "))
 }
 
-func rpcGetLatestLedger(url string, requestBody []byte) (uint32, error) {
-	response, err := http.Post(url, "application/json", bytes.NewBuffer(requestBody))
+func archiveGetLatestLedger(ctx context.Context, client *http.Client, archiveURL string) (uint32, error) {
+	url := strings.TrimSuffix(archiveURL, "/") + "/" + rootHASPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		fmt.Println("Error sending POST request:", err)
 		return 0, err
 	}
-	defer response.Body.Close()
 
-	var responseData map[string]interface{}
-	if err := json.NewDecoder(response.Body).Decode(&responseData); err != nil {
-		fmt.Println("Error reading JSON response:", err)
+	response, err := client.Do(req)
+	if err != nil {
 		return 0, err
 	}
+	defer response.Body.Close()
 
-	result := responseData["result"].(map[string]interface{})
-	latestLedger := result["sequence"].(float64)
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s: unexpected status %s", url, response.Status)
+	}
+
+	var has struct {
+		CurrentLedger uint32 `json:"currentLedger"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&has); err != nil {
+		return 0, fmt.Errorf("%s: %w", url, err)
+	}
+
+	return has.CurrentLedger, nil
+}
 
-	return uint32(latestLedger), nil
+// newHistoryArchive connects to a pool of history archives, each request is
+// served by one of them.
+func newHistoryArchive(ctx context.Context, networkPassphrase string, historyArchiveURLs []string, checkpointFrequency uint32) (historyarchive.ArchiveInterface, error) {
+	return historyarchive.NewArchivePool(historyArchiveURLs, historyarchive.ArchiveOptions{
+		NetworkPassphrase:   networkPassphrase,
+		CheckpointFrequency: checkpointFrequency,
+		ConnectOptions: storage.ConnectOptions{
+			Context:   ctx,
+			UserAgent: UserAgent,
+		},
+	})
 }
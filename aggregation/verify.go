@@ -0,0 +1,223 @@
+package aggregation
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/stellar/go/historyarchive"
+	"github.com/stellar/go/support/log"
+	"github.com/stellar/go/xdr"
+
+	"github.com/decentrio/soro-book/config"
+	db "github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// VerifyError is a ledger whose hashes do not match, it is not committed.
+type VerifyError struct {
+	Ledger uint32
+	Err    error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("error verify ledger %d: %s", e.Ledger, e.Err.Error())
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyStats counts the ledgers checked by Verify
+type VerifyStats struct {
+	Ledgers uint64
+	Missing uint64
+	Failed  uint64
+}
+
+// verifyHeader recomputes the hash of a ledger header, the sha256 hash of
+// its XDR.
+func verifyHeader(entry xdr.LedgerHeaderHistoryEntry) error {
+	bz, err := entry.Header.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("error encode header %w", err)
+	}
+
+	hash := xdr.Hash(sha256.Sum256(bz))
+	if hash != entry.Hash {
+		return fmt.Errorf("header hash %s, recomputed %s", entry.Hash.HexString(), hash.HexString())
+	}
+	return nil
+}
+
+// verifyTxSetResult checks the transaction result set hash of a header
+// against results, the TransactionResultPair XDR of the transactions of the
+// ledger in application order.
+func verifyTxSetResult(header xdr.LedgerHeader, results [][]byte) error {
+	set := xdr.TransactionResultSet{
+		Results: make([]xdr.TransactionResultPair, len(results)),
+	}
+	for i, bz := range results {
+		if err := set.Results[i].UnmarshalBinary(bz); err != nil {
+			return fmt.Errorf("error decode result %d %w", i, err)
+		}
+	}
+
+	bz, err := set.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("error encode result set %w", err)
+	}
+
+	hash := xdr.Hash(sha256.Sum256(bz))
+	if hash != header.TxSetResultHash {
+		return fmt.Errorf("tx set result hash %s, recomputed from %d results %s",
+			header.TxSetResultHash.HexString(), len(results), hash.HexString())
+	}
+	return nil
+}
+
+// verifyCloseMeta recomputes the header hash of a ledger and its
+// transaction result set hash, txWrappers are its transactions in
+// application order.
+func verifyCloseMeta(l xdr.LedgerCloseMeta, txWrappers []TransactionWrapper) error {
+	entry, err := getLedgerHeaderFromCloseMeta(l)
+	if err != nil {
+		return err
+	}
+	if err := verifyHeader(entry); err != nil {
+		return err
+	}
+
+	results := make([][]byte, len(txWrappers))
+	for i, tw := range txWrappers {
+		results[i] = tw.GetResultXdr()
+	}
+	return verifyTxSetResult(entry.Header, results)
+}
+
+// verifyChain checks that a ledger follows the ledger with hash prevHash.
+func verifyChain(ledger models.Ledger, prevHash string) error {
+	if ledger.PrevHash != prevHash {
+		return fmt.Errorf("previous ledger hash %s, stored ledger %d has hash %s", ledger.PrevHash, ledger.Seq-1, prevHash)
+	}
+	return nil
+}
+
+// storedLedgerHash returns the hash of a stored ledger, empty when it is
+// not stored.
+func storedLedgerHash(h *db.DBHandler, seq uint32) (string, error) {
+	ledgers, err := h.GetLedgers(seq, seq)
+	if err != nil || len(ledgers) == 0 {
+		return "", err
+	}
+	return ledgers[0].Hash, nil
+}
+
+// NewNetworkArchive connects to the history archives of the network of cfg.
+func NewNetworkArchive(ctx context.Context, cfg config.AggregationConfig) (historyarchive.ArchiveInterface, error) {
+	networkPassphrase, historyArchiveURLs, _, err := networkParams(cfg, log.DefaultLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	return newHistoryArchive(ctx, networkPassphrase, historyArchiveURLs, CheckpointFrequency(cfg))
+}
+
+// Verify checks the stored ledgers of [from, to] against the headers of the
+// history archive: each ledger must follow the stored ledger before it, its
+// hashes must be those of the archived header, the header hash is
+// recomputed and the transaction result set hash is recomputed from the
+// stored transactions. Ledgers that are not stored are counted as missing.
+// Every ledger that does not match is passed to report. The archive is read
+// one checkpoint at a time, checkpointFrequency is the one of the network.
+func Verify(
+	h *db.DBHandler,
+	archive historyarchive.ArchiveInterface,
+	checkpointFrequency uint32,
+	from, to uint32,
+	report func(err *VerifyError),
+) (VerifyStats, error) {
+	var stats VerifyStats
+
+	prevHash, err := storedLedgerHash(h, from-1)
+	if err != nil {
+		return stats, err
+	}
+
+	// one checkpoint of ledgers at a time
+	for start := from; start <= to; {
+		end := (start/checkpointFrequency+1)*checkpointFrequency - 1
+		if end > to {
+			end = to
+		}
+
+		headers, err := archive.GetLedgers(start, end)
+		if err != nil {
+			return stats, fmt.Errorf("error get archived ledgers [%d, %d]: %w", start, end, err)
+		}
+		ledgers, err := h.GetLedgers(start, end)
+		if err != nil {
+			return stats, err
+		}
+		txs, err := h.GetTransactions(start, end)
+		if err != nil {
+			return stats, err
+		}
+		results := make(map[uint32][][]byte)
+		for _, tx := range txs {
+			results[tx.Ledger] = append(results[tx.Ledger], tx.ResultXdr)
+		}
+
+		stored := make(map[uint32]models.Ledger, len(ledgers))
+		for _, ledger := range ledgers {
+			stored[ledger.Seq] = ledger
+		}
+
+		for seq := start; seq <= end; seq++ {
+			ledger, found := stored[seq]
+			if !found {
+				stats.Missing++
+				prevHash = ""
+				continue
+			}
+			stats.Ledgers++
+
+			if err := verifyStoredLedger(ledger, prevHash, headers[seq], results[seq]); err != nil {
+				stats.Failed++
+				report(&VerifyError{Ledger: seq, Err: err})
+			}
+			prevHash = ledger.Hash
+		}
+
+		if end == to {
+			break
+		}
+		start = end + 1
+	}
+
+	return stats, nil
+}
+
+func verifyStoredLedger(ledger models.Ledger, prevHash string, archived *historyarchive.Ledger, results [][]byte) error {
+	if prevHash != "" {
+		if err := verifyChain(ledger, prevHash); err != nil {
+			return err
+		}
+	}
+	if archived == nil {
+		return fmt.Errorf("not found in the history archive")
+	}
+
+	entry := archived.Header
+	if ledger.Hash != entry.Hash.HexString() {
+		return fmt.Errorf("stored hash %s, archived hash %s", ledger.Hash, entry.Hash.HexString())
+	}
+	if ledger.PrevHash != entry.Header.PreviousLedgerHash.HexString() {
+		return fmt.Errorf("stored previous hash %s, archived previous hash %s", ledger.PrevHash, entry.Header.PreviousLedgerHash.HexString())
+	}
+	if err := verifyHeader(entry); err != nil {
+		return err
+	}
+
+	return verifyTxSetResult(entry.Header, results)
+}
@@ -0,0 +1,131 @@
+package aggregation_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+func testHeaderEntry(t *testing.T) xdr.LedgerHeaderHistoryEntry {
+	header := xdr.LedgerHeader{
+		LedgerSeq:          10,
+		PreviousLedgerHash: sha256.Sum256([]byte("ledger 9")),
+		TxSetResultHash:    sha256.Sum256([]byte("results")),
+	}
+	bz, err := header.MarshalBinary()
+	require.NoError(t, err)
+
+	return xdr.LedgerHeaderHistoryEntry{Hash: sha256.Sum256(bz), Header: header}
+}
+
+func TestVerifyHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tamper func(entry *xdr.LedgerHeaderHistoryEntry)
+		valid  bool
+	}{
+		{"valid", func(entry *xdr.LedgerHeaderHistoryEntry) {}, true},
+		{"tampered header hash", func(entry *xdr.LedgerHeaderHistoryEntry) {
+			entry.Hash[0] ^= 1
+		}, false},
+		{"tampered previous hash", func(entry *xdr.LedgerHeaderHistoryEntry) {
+			entry.Header.PreviousLedgerHash[0] ^= 1
+		}, false},
+		{"tampered result set hash", func(entry *xdr.LedgerHeaderHistoryEntry) {
+			entry.Header.TxSetResultHash[0] ^= 1
+		}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entry := testHeaderEntry(t)
+			tc.tamper(&entry)
+
+			err := aggregation.VerifyHeader(entry)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func testResult(t *testing.T, txHash string, fee int64) []byte {
+	bz, err := xdr.TransactionResultPair{
+		TransactionHash: sha256.Sum256([]byte(txHash)),
+		Result: xdr.TransactionResult{
+			FeeCharged: xdr.Int64(fee),
+			Result: xdr.TransactionResultResult{
+				Code:    xdr.TransactionResultCodeTxSuccess,
+				Results: &[]xdr.OperationResult{},
+			},
+		},
+	}.MarshalBinary()
+	require.NoError(t, err)
+	return bz
+}
+
+func TestVerifyTxSetResult(t *testing.T) {
+	results := [][]byte{testResult(t, "tx1", 100), testResult(t, "tx2", 200)}
+
+	set := xdr.TransactionResultSet{Results: make([]xdr.TransactionResultPair, len(results))}
+	for i, bz := range results {
+		require.NoError(t, set.Results[i].UnmarshalBinary(bz))
+	}
+	bz, err := set.MarshalBinary()
+	require.NoError(t, err)
+	header := xdr.LedgerHeader{LedgerSeq: 10, TxSetResultHash: sha256.Sum256(bz)}
+
+	tamperedHeader := header
+	tamperedHeader.TxSetResultHash[0] ^= 1
+
+	for _, tc := range []struct {
+		name    string
+		header  xdr.LedgerHeader
+		results [][]byte
+		valid   bool
+	}{
+		{"valid", header, results, true},
+		{"tampered result set hash", tamperedHeader, results, false},
+		{"tampered result", header, [][]byte{results[0], testResult(t, "tx2", 201)}, false},
+		{"missing result", header, results[:1], false},
+		{"results out of order", header, [][]byte{results[1], results[0]}, false},
+		{"invalid result", header, [][]byte{results[0], {1, 2, 3}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := aggregation.VerifyTxSetResult(tc.header, tc.results)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	ledger := models.Ledger{Seq: 11, Hash: "hash11", PrevHash: "hash10"}
+
+	for _, tc := range []struct {
+		name     string
+		prevHash string
+		valid    bool
+	}{
+		{"valid", "hash10", true},
+		{"tampered previous hash", "hash10x", false},
+		{"other ledger", "hash9", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := aggregation.VerifyChain(ledger, tc.prevHash)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
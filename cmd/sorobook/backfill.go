@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/lib/cli"
+	"github.com/decentrio/soro-book/manager"
+	"github.com/spf13/cobra"
+)
+
+// NewBackfillCmd returns the command that ingests a closed ledger range
+// and exits once the whole range is written.
+func NewBackfillCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backfill",
+		Short: "Ingest the closed ledger range [--from, --to] and exit",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := ParseConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			from, err := cmd.Flags().GetUint32(cli.FromLedger)
+			if err != nil {
+				return err
+			}
+			to, err := cmd.Flags().GetUint32(cli.ToLedger)
+			if err != nil {
+				return err
+			}
+			if from == 0 || to < from {
+				return fmt.Errorf("invalid ledger range [%d, %d]", from, to)
+			}
+
+			workers, err := cmd.Flags().GetInt(cli.Workers)
+			if err != nil {
+				return err
+			}
+			checkpointsPerChunk, err := cmd.Flags().GetUint32(cli.ChunkCheckpoints)
+			if err != nil {
+				return err
+			}
+
+			aggregationConfig, h, err := resolveNetwork(cmd, config)
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+
+			progressFile := config.BackfillProgressFile("")
+			if len(config.Networks) > 0 {
+				progressFile = config.BackfillProgressFile(aggregation.CursorName(aggregationConfig))
+			}
+
+			b := manager.NewBackfill(aggregationConfig, h, progressFile, from, to, workers, checkpointsPerChunk)
+
+			c := make(chan os.Signal, 1)
+			signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+			stop := make(chan struct{})
+			go func() {
+				<-c
+				close(stop)
+			}()
+
+			stats, err := b.Run(stop)
+
+			done := 0
+			progress := b.Progress()
+			for _, chunk := range progress.Chunks {
+				if chunk.Done {
+					done++
+				}
+			}
+			fmt.Printf("backfill [%d, %d]: %d/%d chunks, %d ledgers, %d transactions, %d events\n",
+				from, to, done, len(progress.Chunks), stats.Ledgers, stats.Transactions, stats.Events)
+
+			return err
+		},
+	}
+
+	cmd.Flags().Uint32(cli.FromLedger, 0, "first ledger of the range")
+	cmd.Flags().Uint32(cli.ToLedger, 0, "last ledger of the range")
+	cmd.Flags().Int(cli.Workers, manager.DefaultBackfillWorkers, "number of chunks ingested in parallel")
+	cmd.Flags().Uint32(cli.ChunkCheckpoints, manager.DefaultBackfillCheckpointsPerChunk, "number of checkpoints in each chunk")
+
+	return cmd
+}
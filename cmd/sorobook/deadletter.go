@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/spf13/cobra"
+)
+
+// NewDeadLetterCmd returns the command that inspects and replays the
+// records that failed to persist.
+func NewDeadLetterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deadletter",
+		Short: "Inspect and replay the records that failed to persist",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the dead letters, oldest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := ParseConfig(cmd)
+			if err != nil {
+				return err
+			}
+			_, h, err := resolveNetwork(cmd, config)
+			if err != nil {
+				return err
+			}
+
+			deadLetters, err := h.GetDeadLetters()
+			if err != nil {
+				return err
+			}
+
+			for _, d := range deadLetters {
+				fmt.Printf("%d\tledger %d\ttx %s\t%s\t%s\t%s\n",
+					d.Id, d.Ledger, d.TxHash, d.ModelType, d.CreatedAt.Format("2006-01-02 15:04:05"), d.Error)
+			}
+			fmt.Printf("%d dead letters\n", len(deadLetters))
+
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "retry [id...]",
+		Short: "Decode and write again the dead letters with the given ids, or all of them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var ids []uint64
+			for _, arg := range args {
+				id, err := strconv.ParseUint(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid dead letter id %s: %w", arg, err)
+				}
+				ids = append(ids, id)
+			}
+
+			config, err := ParseConfig(cmd)
+			if err != nil {
+				return err
+			}
+			aggregationConfig, h, err := resolveNetwork(cmd, config)
+			if err != nil {
+				return err
+			}
+			// replayed records go through the same filter as ingestion
+			filter := aggregation.NewContractFilter(aggregationConfig.Filter)
+
+			deadLetters, err := h.GetDeadLetters(ids...)
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, d := range deadLetters {
+				if err := aggregation.RetryDeadLetter(h, d, filter); err != nil {
+					failed++
+					fmt.Printf("%d\tledger %d\ttx %s\t%s\tfailed: %s\n", d.Id, d.Ledger, d.TxHash, d.ModelType, err.Error())
+					if err := h.UpdateDeadLetterError(d.Id, err.Error()); err != nil {
+						return err
+					}
+					continue
+				}
+				fmt.Printf("%d\tledger %d\ttx %s\t%s\tpersisted\n", d.Id, d.Ledger, d.TxHash, d.ModelType)
+			}
+			fmt.Printf("retry: %d persisted, %d failed\n", len(deadLetters)-failed, failed)
+
+			if failed > 0 {
+				return fmt.Errorf("%d dead letters failed again", failed)
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/decentrio/soro-book/lib/cli"
+	"github.com/decentrio/soro-book/manager"
+	"github.com/spf13/cobra"
+)
+
+// NewGapsCmd returns the command that lists the ledgers missing from the
+// database and optionally ingests them again.
+func NewGapsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gaps",
+		Short: "List the ledgers of [--from, --to] missing from the database, ingest them again with --repair",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := cmd.Flags().GetUint32(cli.FromLedger)
+			if err != nil {
+				return err
+			}
+			to, err := cmd.Flags().GetUint32(cli.ToLedger)
+			if err != nil {
+				return err
+			}
+			repair, err := cmd.Flags().GetBool(cli.Repair)
+			if err != nil {
+				return err
+			}
+
+			config, err := ParseConfig(cmd)
+			if err != nil {
+				return err
+			}
+			aggregationConfig, h, err := resolveNetwork(cmd, config)
+			if err != nil {
+				return err
+			}
+
+			// the range defaults to the stored ledgers
+			if from == 0 || to == 0 {
+				lowest, highest, found, err := h.GetLedgerBounds()
+				if err != nil {
+					return err
+				}
+				if !found {
+					return fmt.Errorf("no ledger stored")
+				}
+				if from == 0 {
+					from = lowest
+				}
+				if to == 0 {
+					to = highest
+				}
+			}
+			if to < from {
+				return fmt.Errorf("invalid ledger range [%d, %d]", from, to)
+			}
+
+			gaps, err := h.GetLedgerGaps(from, to)
+			if err != nil {
+				return err
+			}
+
+			missing := uint32(0)
+			for _, gap := range gaps {
+				fmt.Printf("[%d, %d]\t%d ledgers\n", gap.From, gap.To, gap.To-gap.From+1)
+				missing += gap.To - gap.From + 1
+			}
+			fmt.Printf("gaps [%d, %d]: %d gaps, %d missing ledgers\n", from, to, len(gaps), missing)
+
+			if !repair || len(gaps) == 0 {
+				return nil
+			}
+
+			c := make(chan os.Signal, 1)
+			signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+			stop := make(chan struct{})
+			go func() {
+				<-c
+				close(stop)
+			}()
+
+			stats, err := manager.RepairGaps(*aggregationConfig, h, gaps, stop)
+			fmt.Printf("repair: %d ledgers, %d transactions, %d events\n", stats.Ledgers, stats.Transactions, stats.Events)
+
+			return err
+		},
+	}
+
+	cmd.Flags().Uint32(cli.FromLedger, 0, "first ledger of the range, the lowest stored ledger by default")
+	cmd.Flags().Uint32(cli.ToLedger, 0, "last ledger of the range, the highest stored ledger by default")
+	cmd.Flags().Bool(cli.Repair, false, "ingest the missing ledgers again through the configured backend")
+
+	return cmd
+}
@@ -9,6 +9,12 @@ import (
 
 func main() {
 	rootCmd.AddCommand(NewRunNodeCmd())
+	rootCmd.AddCommand(NewBackfillCmd())
+	rootCmd.AddCommand(NewReindexCmd())
+	rootCmd.AddCommand(NewDeadLetterCmd())
+	rootCmd.AddCommand(NewGapsCmd())
+	rootCmd.AddCommand(NewVerifyCmd())
+	rootCmd.AddCommand(NewRollbackCmd())
 	cmd := cli.PrepareBaseCmd(rootCmd, "CMT", os.ExpandEnv(filepath.Join("$HOME", DefaultCometDir)))
 	if err := cmd.Execute(); err != nil {
 		panic(err)
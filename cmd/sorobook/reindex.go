@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/lib/cli"
+	"github.com/spf13/cobra"
+)
+
+// NewReindexCmd returns the command that rebuilds the records derived from
+// the transactions stored in the database, without reading any ledger.
+func NewReindexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuild contract data, invocations and events of [--from, --to] from stored transactions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := cmd.Flags().GetUint32(cli.FromLedger)
+			if err != nil {
+				return err
+			}
+			to, err := cmd.Flags().GetUint32(cli.ToLedger)
+			if err != nil {
+				return err
+			}
+			if from == 0 || to < from {
+				return fmt.Errorf("invalid ledger range [%d, %d]", from, to)
+			}
+
+			config, err := ParseConfig(cmd)
+			if err != nil {
+				return err
+			}
+			aggregationConfig, h, err := resolveNetwork(cmd, config)
+			if err != nil {
+				return err
+			}
+
+			filter := aggregation.NewContractFilter(aggregationConfig.Filter)
+			stats, err := aggregation.Reindex(h, from, to, filter)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("reindex [%d, %d]: %d transactions, %d invocations, %d created contracts, %d contract data entries, %d events\n",
+				from, to, stats.Transactions, stats.InvokeTransactions, stats.CreatedContracts, stats.ContractsData, stats.Events)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().Uint32(cli.FromLedger, 0, "first ledger of the range")
+	cmd.Flags().Uint32(cli.ToLedger, 0, "last ledger of the range")
+
+	return cmd
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/lib/cli"
+	"github.com/spf13/cobra"
+)
+
+// NewRollbackCmd returns the command that deletes everything indexed above
+// a ledger, so ingestion resumes right after it.
+func NewRollbackCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Delete everything indexed above ledger --to, restore the contract data newest at --to and reset the cursor",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			to, err := cmd.Flags().GetUint32(cli.ToLedger)
+			if err != nil {
+				return err
+			}
+			if to == 0 {
+				return fmt.Errorf("invalid ledger %d", to)
+			}
+
+			config, err := ParseConfig(cmd)
+			if err != nil {
+				return err
+			}
+			aggregationConfig, h, err := resolveNetwork(cmd, config)
+			if err != nil {
+				return err
+			}
+
+			cursorName := aggregation.CursorName(aggregationConfig)
+			deleted, err := h.Rollback(cursorName, to)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("rollback %s to %d: %d ledgers deleted\n", cursorName, to, deleted)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().Uint32(cli.ToLedger, 0, "last ledger to keep")
+
+	return cmd
+}
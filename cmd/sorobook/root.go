@@ -3,11 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"os/signal"
 	"syscall"
 
 	cfg "github.com/decentrio/soro-book/config"
+	db "github.com/decentrio/soro-book/database/handlers"
 	"github.com/decentrio/soro-book/lib/cli"
 	"github.com/decentrio/soro-book/manager"
 	"github.com/spf13/cobra"
@@ -42,19 +42,18 @@ func NewRunNodeCmd() *cobra.Command {
 			c := make(chan os.Signal, 1)
 			signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-			go func() {
-				for range c {
-					if m.IsRunning() {
-						if err := m.Stop(); err != nil {
-							fmt.Printf(err.Error())
-						}
-					}
-					os.Exit(0)
+			// Run until stopped or a network halts, the state is saved
+			// either way.
+			select {
+			case <-c:
+			case <-m.Halted():
+			}
+			if m.IsRunning() {
+				if err := m.Stop(); err != nil {
+					fmt.Printf(err.Error())
 				}
-			}()
-
-			// Run forever.
-			select {}
+			}
+			return m.Err()
 		},
 	}
 
@@ -91,26 +90,187 @@ func ParseConfig(cmd *cobra.Command) (*cfg.ManagerConfig, error) {
 			aggregationConfig.StartLedgerHeight = startLedger
 		}
 
-		currLedger, err := cmd.Flags().GetUint32(cli.CurrentLedger)
+		network, err := cmd.Flags().GetString(cli.NetWork)
 		if err != nil {
 			return nil, err
 		}
-		aggregationConfig.CurrLedgerHeight = currLedger
+		aggregationConfig.Network = network
 
-		network, err := cmd.Flags().GetString(cli.NetWork)
+		networkPassphrase, err := cmd.Flags().GetString(cli.NetworkPassphrase)
 		if err != nil {
 			return nil, err
 		}
-		aggregationConfig.Network = network
+		aggregationConfig.NetworkPassphrase = networkPassphrase
+
+		historyArchiveURLs, err := cmd.Flags().GetStringSlice(cli.HistoryArchiveURLs)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.HistoryArchiveURLs = historyArchiveURLs
+
+		captiveCoreConfig, err := cmd.Flags().GetString(cli.CaptiveCoreConfig)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.CaptiveCoreConfigPath = captiveCoreConfig
+
+		coreStoragePath, err := cmd.Flags().GetString(cli.CoreStoragePath)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.CoreStoragePath = coreStoragePath
+
+		coreLogLevel, err := cmd.Flags().GetString(cli.CoreLogLevel)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.CoreLogLevel = coreLogLevel
+
+		backend, err := cmd.Flags().GetString(cli.Backend)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.BackendType = backend
+
+		backendTypes, err := cmd.Flags().GetStringSlice(cli.Backends)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.Backends = backendTypes
+
+		ledgerDir, err := cmd.Flags().GetString(cli.LedgerDir)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.LedgerDir = ledgerDir
+
+		rpcURL, err := cmd.Flags().GetString(cli.RPCURL)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.RPCURL = rpcURL
+
+		archiveDir, err := cmd.Flags().GetString(cli.ArchiveDir)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.ArchiveDir = archiveDir
+
+		queueSize, err := cmd.Flags().GetUint32(cli.QueueSize)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.QueueSize = queueSize
+
+		decodeWorkers, err := cmd.Flags().GetUint32(cli.DecodeWorkers)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.DecodeWorkers = decodeWorkers
+
+		flushSize, err := cmd.Flags().GetUint32(cli.FlushSize)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.FlushSize = flushSize
+
+		flushInterval, err := cmd.Flags().GetUint32(cli.FlushInterval)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.FlushInterval = flushInterval
+
+		shutdownTimeout, err := cmd.Flags().GetUint32(cli.ShutdownTimeout)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.ShutdownTimeout = shutdownTimeout
+
+		retryTimeout, err := cmd.Flags().GetUint32(cli.RetryTimeout)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.RetryTimeout = retryTimeout
+
+		gapScanInterval, err := cmd.Flags().GetUint32(cli.GapScanInterval)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.GapScanInterval = gapScanInterval
+
+		skipVerify, err := cmd.Flags().GetBool(cli.SkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.SkipVerify = skipVerify
+
+		bootstrap, err := cmd.Flags().GetBool(cli.Bootstrap)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.Bootstrap = bootstrap
+
+		contracts, err := cmd.Flags().GetStringSlice(cli.Contracts)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.Filter.Contracts = contracts
+
+		excludeContracts, err := cmd.Flags().GetStringSlice(cli.ExcludeContracts)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.Filter.ExcludeContracts = excludeContracts
+
+		accounts, err := cmd.Flags().GetStringSlice(cli.Accounts)
+		if err != nil {
+			return nil, err
+		}
+		aggregationConfig.Filter.Accounts = accounts
+	}
 
-		stellarCoreBinaryPath, err := exec.LookPath("stellar-core")
+	// an explicit --start wins over the saved config and the database cursor
+	if cmd.Flags().Changed(cli.StartLedger) {
+		startLedger, err := cmd.Flags().GetUint32(cli.StartLedger)
 		if err != nil {
 			return nil, err
 		}
-		aggregationConfig.BinaryPath = stellarCoreBinaryPath
+		aggregationConfig.StartLedgerHeight = startLedger
+		aggregationConfig.StartExplicit = true
 	}
 
 	conf.AggregationCfg = &aggregationConfig
 
+	// each network resumes from its own saved config and cursor
+	for i := range conf.Networks {
+		n := &conf.Networks[i]
+		if n.Name == "" {
+			return nil, fmt.Errorf("network %d has no name", i)
+		}
+
+		stateFile := conf.NetworkAggregationConfigFile(n.Name)
+		if cfg.FileExists(stateFile) {
+			n.Aggregation = cfg.LoadAggregationConfig(stateFile)
+		}
+		// networks may share the same stellar network, not the same cursor
+		n.Aggregation.Cursor = n.Name
+	}
+
 	return conf, nil
 }
+
+// resolveNetwork returns the config and the database handler of the network
+// named with --network, or of the only configured network when the flag is
+// not set.
+func resolveNetwork(cmd *cobra.Command, conf *cfg.ManagerConfig) (*cfg.AggregationConfig, *db.DBHandler, error) {
+	var name string
+	if cmd.Flags().Changed(cli.NetWork) {
+		var err error
+		name, err = cmd.Flags().GetString(cli.NetWork)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return manager.ResolveNetwork(conf, name)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/lib/cli"
+	"github.com/spf13/cobra"
+)
+
+// NewVerifyCmd returns the command that checks the stored ledgers against
+// the history archive of the network.
+func NewVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the hash chain, header hashes and transaction result set hashes of the ledgers of [--from, --to]",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := cmd.Flags().GetUint32(cli.FromLedger)
+			if err != nil {
+				return err
+			}
+			to, err := cmd.Flags().GetUint32(cli.ToLedger)
+			if err != nil {
+				return err
+			}
+			if from == 0 || to < from {
+				return fmt.Errorf("invalid ledger range [%d, %d]", from, to)
+			}
+
+			config, err := ParseConfig(cmd)
+			if err != nil {
+				return err
+			}
+			aggregationConfig, h, err := resolveNetwork(cmd, config)
+			if err != nil {
+				return err
+			}
+			archive, err := aggregation.NewNetworkArchive(context.Background(), *aggregationConfig)
+			if err != nil {
+				return err
+			}
+
+			frequency := aggregation.CheckpointFrequency(*aggregationConfig)
+			stats, err := aggregation.Verify(h, archive, frequency, from, to, func(err *aggregation.VerifyError) {
+				fmt.Println(err.Error())
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("verify [%d, %d]: %d ledgers, %d failed, %d missing\n",
+				from, to, stats.Ledgers, stats.Failed, stats.Missing)
+
+			if stats.Failed > 0 {
+				return fmt.Errorf("%d ledgers failed verification", stats.Failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Uint32(cli.FromLedger, 0, "first ledger of the range")
+	cmd.Flags().Uint32(cli.ToLedger, 0, "last ledger of the range")
+
+	return cmd
+}
@@ -11,11 +11,26 @@ const (
 
 	DefaultManagerConfigFileName     = "managerConfig.json"
 	DefaultAggregationConfigFileName = "aggregationConfig.json"
+	DefaultBackfillProgressFileName  = "backfillProgress.json"
 )
 
 type ManagerConfig struct {
 	RootDir        string
 	AggregationCfg *AggregationConfig
+
+	// Networks indexed side by side, AggregationCfg is used when empty
+	Networks []NetworkConfig `json:"networks,omitempty"`
+}
+
+// NetworkConfig is a named network with its own aggregation service, cursor
+// and database.
+type NetworkConfig struct {
+	Name string `json:"name"`
+	// PostgresURL defaults to POSTGRES_URL
+	PostgresURL string `json:"postgres_url,omitempty"`
+	// Schema is the Postgres schema of the network tables
+	Schema      string            `json:"schema,omitempty"`
+	Aggregation AggregationConfig `json:"aggregation"`
 }
 
 func DefaultConfig() *ManagerConfig {
@@ -41,6 +56,19 @@ func (c *ManagerConfig) AggregationConfigFile() string {
 	return rootify(DefaultAggregationConfigFileName, c.RootDir)
 }
 
+// NetworkAggregationConfigFile is where the aggregation config and cursor of
+// network name are saved.
+func (c *ManagerConfig) NetworkAggregationConfigFile(name string) string {
+	return rootify(filepath.Join(name, DefaultAggregationConfigFileName), c.RootDir)
+}
+
+// BackfillProgressFile is where the progress of a backfill of network name
+// is saved, next to its aggregation config. An empty name is the only
+// configured network.
+func (c *ManagerConfig) BackfillProgressFile(name string) string {
+	return rootify(filepath.Join(name, DefaultBackfillProgressFileName), c.RootDir)
+}
+
 func (c *ManagerConfig) LoadManagerConfig(path string) {
 	bz, err := os.ReadFile(path)
 	if err != nil {
@@ -56,8 +84,82 @@ func (c *ManagerConfig) LoadManagerConfig(path string) {
 type AggregationConfig struct {
 	Network           string `json:"network,omitempty"`
 	BinaryPath        string `json:"binary_path,omitempty"`
+	RPCURL            string `json:"rpc_url,omitempty"`
 	StartLedgerHeight uint32 `json:"start_ledger_height,omitempty"`
-	CurrLedgerHeight  uint32 `json:"curr_ledger_height,omitempty"`
+	EndLedgerHeight   uint32 `json:"end_ledger_height,omitempty"`
+	// StartExplicit is set when --start is passed, StartLedgerHeight then
+	// takes precedence over the cursor stored in the database
+	StartExplicit bool `json:"-"`
+	// Cursor names the cursor of the live ingestion, the name of the network
+	// when several are configured and Network otherwise
+	Cursor string `json:"-"`
+
+	// Custom networks, these override the defaults of pubnet and testnet
+	NetworkPassphrase     string   `json:"network_passphrase,omitempty"`
+	HistoryArchiveURLs    []string `json:"history_archive_urls,omitempty"`
+	CaptiveCoreConfigPath string   `json:"captive_core_config_path,omitempty"`
+	CheckpointFrequency   uint32   `json:"checkpoint_frequency,omitempty"`
+
+	// Captive core, CoreStoragePath defaults to a temporary directory and
+	// CoreLogLevel (debug/info/warn/error) to info
+	CoreStoragePath string `json:"core_storage_path,omitempty"`
+	CoreInMemory    bool   `json:"core_in_memory,omitempty"`
+	CoreLogLevel    string `json:"core_log_level,omitempty"`
+
+	// BackendType selects where ledgers are read from, captive core by default
+	BackendType string `json:"backend_type,omitempty"`
+	// LedgerDir is the directory of ledger exporter files used by the file backend
+	LedgerDir         string `json:"ledger_dir,omitempty"`
+	LedgersPerFile    uint32 `json:"ledgers_per_file,omitempty"`
+	FilesPerPartition uint32 `json:"files_per_partition,omitempty"`
+	// ArchiveDir enables writing every raw ledger into a local archive
+	ArchiveDir string `json:"archive_dir,omitempty"`
+
+	// Backends is an ordered list of backend types used with failover,
+	// it takes precedence over BackendType
+	Backends []string `json:"backends,omitempty"`
+	// BackendStallTimeout and PrimaryRetryInterval are in seconds
+	BackendStallTimeout  uint32 `json:"backend_stall_timeout,omitempty"`
+	PrimaryRetryInterval uint32 `json:"primary_retry_interval,omitempty"`
+
+	// QueueSize bounds the ledgers fetched ahead of the last committed one,
+	// DecodeWorkers is the number of ledgers decoded in parallel
+	QueueSize     uint32 `json:"queue_size,omitempty"`
+	DecodeWorkers uint32 `json:"decode_workers,omitempty"`
+	// FlushSize is the number of rows buffered before they are written,
+	// FlushInterval the longest they stay buffered in milliseconds
+	FlushSize     uint32 `json:"flush_size,omitempty"`
+	FlushInterval uint32 `json:"flush_interval,omitempty"`
+	// ShutdownTimeout bounds in seconds how long stopping waits for the
+	// fetched ledgers to be committed
+	ShutdownTimeout uint32 `json:"shutdown_timeout,omitempty"`
+	// RetryTimeout bounds in seconds how long a failing fetch or write is
+	// retried before ingestion halts
+	RetryTimeout uint32 `json:"retry_timeout,omitempty"`
+
+	// GapScanInterval is the number of seconds between two scans for ledgers
+	// missing below the cursor, 0 disables the scanner
+	GapScanInterval uint32 `json:"gap_scan_interval,omitempty"`
+
+	// SkipVerify disables checking the hash chain, the header hash and the
+	// transaction result set hash of every ingested ledger
+	SkipVerify bool `json:"skip_verify,omitempty"`
+
+	// Bootstrap seeds the contract state from the history archive
+	// checkpoint at or before StartLedgerHeight before ingesting
+	Bootstrap bool `json:"bootstrap,omitempty"`
+
+	// Filter limits the contract records that are persisted, ledgers and
+	// transactions are always recorded
+	Filter FilterConfig `json:"filter,omitempty"`
+}
+
+// FilterConfig lists the contracts and accounts sorobook persists records
+// of. Empty lists let everything through.
+type FilterConfig struct {
+	Contracts        []string `json:"contracts,omitempty"`
+	ExcludeContracts []string `json:"exclude_contracts,omitempty"`
+	Accounts         []string `json:"accounts,omitempty"`
 }
 
 func LoadAggregationConfig(path string) AggregationConfig {
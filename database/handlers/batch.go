@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// Batch buffers the rows of one or more ledgers so they are written with
+// multi-row inserts, table by table.
+type Batch struct {
+	Ledgers            []models.Ledger
+	Transactions       []models.Transaction
+	InvokeTransactions []models.InvokeTransaction
+	ContractsCodes     []models.ContractsCode
+	// ContractsData must be in ledger and application order
+	ContractsData  []models.ContractsData
+	WasmEvents     []models.WasmContractEvent
+	TransferEvents []models.AssetContractTransferEvent
+	MintEvents     []models.AssetContractMintEvent
+	BurnEvents     []models.AssetContractBurnEvent
+	ClawbackEvents []models.AssetContractClawbackEvent
+}
+
+// AddAssetContractEvent buffers a stellar asset contract event with the
+// events of its type.
+func (b *Batch) AddAssetContractEvent(event models.StellarAssetContractEvent) error {
+	switch e := event.(type) {
+	case *models.AssetContractTransferEvent:
+		b.TransferEvents = append(b.TransferEvents, *e)
+	case *models.AssetContractMintEvent:
+		b.MintEvents = append(b.MintEvents, *e)
+	case *models.AssetContractBurnEvent:
+		b.BurnEvents = append(b.BurnEvents, *e)
+	case *models.AssetContractClawbackEvent:
+		b.ClawbackEvents = append(b.ClawbackEvents, *e)
+	default:
+		return fmt.Errorf("event type ('%s') unsupported", event.GetType())
+	}
+
+	return nil
+}
+
+// Len returns the number of buffered rows.
+func (b *Batch) Len() int {
+	return len(b.Ledgers) + len(b.Transactions) + len(b.InvokeTransactions) +
+		len(b.ContractsCodes) + len(b.ContractsData) + len(b.WasmEvents) +
+		len(b.TransferEvents) + len(b.MintEvents) + len(b.BurnEvents) + len(b.ClawbackEvents)
+}
+
+// WriteBatch writes the buffered rows with upserts of at most batchSize
+// rows. Run it in a transaction to write the batch atomically.
+func (h *DBHandler) WriteBatch(b *Batch, batchSize int) error {
+	writes := []struct {
+		table string
+		write func() error
+	}{
+		{"ledgers", func() error { return upsertBatch(h, b.Ledgers, batchSize, "seq") }},
+		{"transactions", func() error { return upsertBatch(h, b.Transactions, batchSize, "hash") }},
+		{"invoke_transactions", func() error { return upsertBatch(h, b.InvokeTransactions, batchSize, "hash") }},
+		{"contracts_codes", func() error { return upsertBatch(h, b.ContractsCodes, batchSize, "contract_id") }},
+		{"contracts_data", func() error { return h.createContractsDataBatch(b.ContractsData, batchSize) }},
+		{"wasm_contract_events", func() error { return upsertBatch(h, b.WasmEvents, batchSize, "id") }},
+		{"asset_contract_transfer_events", func() error { return upsertBatch(h, b.TransferEvents, batchSize, "id") }},
+		{"asset_contract_mint_events", func() error { return upsertBatch(h, b.MintEvents, batchSize, "id") }},
+		{"asset_contract_burn_events", func() error { return upsertBatch(h, b.BurnEvents, batchSize, "id") }},
+		{"asset_contract_clawback_events", func() error { return upsertBatch(h, b.ClawbackEvents, batchSize, "id") }},
+	}
+
+	for _, w := range writes {
+		if err := w.write(); err != nil {
+			return fmt.Errorf("error write %s: %w", w.table, err)
+		}
+	}
+
+	return nil
+}
+
+func upsertBatch[T any](h *DBHandler, rows []T, batchSize int, keys ...string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return h.db.Clauses(onConflictUpdateAll(keys...)).CreateInBatches(rows, batchSize).Error
+}
+
+// createContractsDataBatch stores contract data entries and supersedes the
+// previous newest entry of their keys the way CreateContractEntry does,
+// whether that entry is in the batch or already stored.
+func (h *DBHandler) createContractsDataBatch(entries []models.ContractsData, batchSize int) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// entries that are already stored are left as is
+	stored := make(map[string]struct{})
+	for from := 0; from < len(entries); from += batchSize {
+		to := min(from+batchSize, len(entries))
+		ids := make([]string, 0, to-from)
+		for _, e := range entries[from:to] {
+			ids = append(ids, e.Id)
+		}
+
+		var found []string
+		if err := h.db.Model(&models.ContractsData{}).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+			return err
+		}
+		for _, id := range found {
+			stored[id] = struct{}{}
+		}
+	}
+
+	type entryKey struct {
+		contractId string
+		keyXdr     string
+	}
+	fresh := make([]models.ContractsData, 0, len(entries))
+	newest := make(map[entryKey]int)
+	// entries whose key's newest entry is stored, it is superseded
+	var superseding []models.ContractsData
+	for _, e := range entries {
+		if _, found := stored[e.Id]; found {
+			continue
+		}
+
+		key := entryKey{e.ContractId, string(e.KeyXdr)}
+		if e.EntryType == "updated" || e.EntryType == "removed" {
+			if i, found := newest[key]; found {
+				fresh[i].IsNewest = false
+				fresh[i].UpdatedLedger = e.Ledger - 1
+			} else {
+				superseding = append(superseding, e)
+			}
+		}
+
+		fresh = append(fresh, e)
+		newest[key] = len(fresh) - 1
+	}
+
+	if err := h.supersedeContractsData(superseding, batchSize); err != nil {
+		return err
+	}
+
+	if len(fresh) == 0 {
+		return nil
+	}
+	return h.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(fresh, batchSize).Error
+}
+
+// supersedeContractsData marks the stored newest entries of the keys of
+// entries as superseded by them, with one statement per batchSize entries.
+// entries must have distinct keys.
+func (h *DBHandler) supersedeContractsData(entries []models.ContractsData, batchSize int) error {
+	for from := 0; from < len(entries); from += batchSize {
+		to := min(from+batchSize, len(entries))
+		values := make([]string, 0, to-from)
+		args := make([]interface{}, 0, 3*(to-from))
+		for _, e := range entries[from:to] {
+			values = append(values, "(?::text, ?::bytea, ?::bigint)")
+			args = append(args, e.ContractId, e.KeyXdr, e.Ledger-1)
+		}
+
+		query := fmt.Sprintf(`
+UPDATE contracts_data AS c
+SET is_newest = false, updated_ledger = v.updated_ledger
+FROM (VALUES %s) AS v (contract_id, key_xdr, updated_ledger)
+WHERE c.contract_id = v.contract_id AND c.key_xdr = v.key_xdr AND c.is_newest = true`, strings.Join(values, ", "))
+		if err := h.db.Exec(query, args...).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package handlers_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+const (
+	benchTxsPerLedger    = 50
+	benchLedgersPerBatch = 20
+	// benchLedgerBase keeps benchmark rows away from real ledgers, they are
+	// rolled back anyway
+	benchLedgerBase = 2_000_000_000
+)
+
+var errRollback = errors.New("rollback")
+
+func newBenchHandler(b *testing.B) *handlers.DBHandler {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		b.Skip("POSTGRES_URL is not set")
+	}
+	return handlers.NewDBHandler()
+}
+
+// benchLedger returns the rows of a ledger with soroban transactions that
+// each invoke a contract, change two contract data entries and emit two events.
+func benchLedger(seq uint32) handlers.Batch {
+	batch := handlers.Batch{
+		Ledgers: []models.Ledger{{Hash: fmt.Sprintf("%064x", seq), Seq: seq, Transactions: benchTxsPerLedger}},
+	}
+	for i := 0; i < benchTxsPerLedger; i++ {
+		hash := fmt.Sprintf("%056x%08x", seq, i)
+		contractId := fmt.Sprintf("C%055d", i)
+		batch.Transactions = append(batch.Transactions, models.Transaction{
+			Hash:             hash,
+			Status:           "success",
+			Ledger:           seq,
+			ApplicationOrder: uint32(i + 1),
+			EnvelopeXdr:      make([]byte, 512),
+			ResultXdr:        make([]byte, 128),
+			ResultMetaXdr:    make([]byte, 2048),
+		})
+		batch.InvokeTransactions = append(batch.InvokeTransactions, models.InvokeTransaction{
+			Hash:         hash,
+			ContractId:   contractId,
+			FunctionType: "invoke_host_function",
+			FunctionName: "transfer",
+			Args:         make([]byte, 128),
+		})
+		for k := 0; k < 2; k++ {
+			batch.ContractsData = append(batch.ContractsData, models.ContractsData{
+				Id:            uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s-%d", hash, k))).String(),
+				ContractId:    contractId,
+				TxHash:        hash,
+				Ledger:        seq,
+				EntryType:     "updated",
+				KeyXdr:        []byte(fmt.Sprintf("key-%d", k)),
+				ValueXdr:      make([]byte, 64),
+				IsNewest:      true,
+				UpdatedLedger: math.MaxInt32,
+			})
+			batch.WasmEvents = append(batch.WasmEvents, models.WasmContractEvent{
+				Id:           fmt.Sprintf("%019d-%010d", int64(seq)<<12|int64(i), k),
+				ContractId:   contractId,
+				TxHash:       hash,
+				EventBodyXdr: make([]byte, 256),
+			})
+		}
+	}
+	return batch
+}
+
+// BenchmarkWriteRowByRow writes every row with its own insert, one ledger
+// per transaction.
+func BenchmarkWriteRowByRow(b *testing.B) {
+	h := newBenchHandler(b)
+
+	err := h.Transaction(func(h *handlers.DBHandler) error {
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			batch := benchLedger(benchLedgerBase + uint32(n))
+			if _, err := h.CreateLedger(&batch.Ledgers[0]); err != nil {
+				return err
+			}
+			for i := range batch.Transactions {
+				if _, err := h.CreateTransaction(&batch.Transactions[i]); err != nil {
+					return err
+				}
+			}
+			for i := range batch.InvokeTransactions {
+				if _, err := h.CreateContractInvokedTransaction(&batch.InvokeTransactions[i]); err != nil {
+					return err
+				}
+			}
+			for i := range batch.ContractsData {
+				if _, err := h.CreateContractEntry(&batch.ContractsData[i]); err != nil {
+					return err
+				}
+			}
+			for i := range batch.WasmEvents {
+				if _, err := h.CreateWasmContractEvent(&batch.WasmEvents[i]); err != nil {
+					return err
+				}
+			}
+		}
+		b.StopTimer()
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ledgers/s")
+}
+
+// BenchmarkWriteBatch buffers the rows of several ledgers and writes them
+// with multi-row upserts.
+func BenchmarkWriteBatch(b *testing.B) {
+	h := newBenchHandler(b)
+
+	err := h.Transaction(func(h *handlers.DBHandler) error {
+		b.ResetTimer()
+		var batch handlers.Batch
+		for n := 0; n < b.N; n++ {
+			ledger := benchLedger(benchLedgerBase + uint32(n))
+			batch.Ledgers = append(batch.Ledgers, ledger.Ledgers...)
+			batch.Transactions = append(batch.Transactions, ledger.Transactions...)
+			batch.InvokeTransactions = append(batch.InvokeTransactions, ledger.InvokeTransactions...)
+			batch.ContractsData = append(batch.ContractsData, ledger.ContractsData...)
+			batch.WasmEvents = append(batch.WasmEvents, ledger.WasmEvents...)
+
+			if len(batch.Ledgers) == benchLedgersPerBatch || n == b.N-1 {
+				if err := h.WriteBatch(&batch, 1000); err != nil {
+					return err
+				}
+				batch = handlers.Batch{}
+			}
+		}
+		b.StopTimer()
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ledgers/s")
+}
+
+// TestWriteTwice writes the same ledgers twice, as when ingestion restarts
+// before the cursor moved, and checks that no row is duplicated or changed.
+func TestWriteTwice(t *testing.T) {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	h := handlers.NewDBHandler()
+
+	err := h.Transaction(func(h *handlers.DBHandler) error {
+		first, last := uint32(benchLedgerBase+1), uint32(benchLedgerBase+3)
+		for i := 0; i < 2; i++ {
+			// batched writes
+			for _, seq := range []uint32{first, first + 1} {
+				batch := benchLedger(seq)
+				require.NoError(t, h.WriteBatch(&batch, 1000))
+			}
+
+			// row by row writes
+			batch := benchLedger(last)
+			_, err := h.CreateLedger(&batch.Ledgers[0])
+			require.NoError(t, err)
+			for i := range batch.Transactions {
+				_, err := h.CreateTransaction(&batch.Transactions[i])
+				require.NoError(t, err)
+			}
+			for i := range batch.ContractsData {
+				_, err := h.CreateContractEntry(&batch.ContractsData[i])
+				require.NoError(t, err)
+			}
+		}
+
+		ledgers, err := h.GetLedgers(first, last)
+		require.NoError(t, err)
+		require.Len(t, ledgers, 3)
+
+		txs, err := h.GetTransactions(first, last)
+		require.NoError(t, err)
+		require.Len(t, txs, 3*benchTxsPerLedger)
+
+		// two keys per ledger, only the entries of the last ledger are newest
+		entries, err := h.GetContractData(fmt.Sprintf("C%055d", 0))
+		require.NoError(t, err)
+		require.Len(t, entries, 6)
+		for _, entry := range entries {
+			require.Equal(t, entry.Ledger == last, entry.IsNewest)
+			if entry.Ledger != last {
+				require.Equal(t, entry.Ledger, entry.UpdatedLedger)
+			}
+		}
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
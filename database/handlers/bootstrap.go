@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"gorm.io/gorm/clause"
+
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// EntryTypeCheckpoint is the entry type of contract data entries seeded
+// from a history archive checkpoint
+const EntryTypeCheckpoint = "checkpoint"
+
+// Migrate creates the tables of dst, or adds their missing columns.
+func (h *DBHandler) Migrate(dst ...interface{}) error {
+	return h.db.AutoMigrate(dst...)
+}
+
+// HasContractDataOfType reports whether a contract data entry of entryType
+// was stored.
+func (h *DBHandler) HasContractDataOfType(entryType string) (bool, error) {
+	var count int64
+	err := h.db.Model(&models.ContractsData{}).
+		Where("entry_type = ?", entryType).
+		Limit(1).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (h *DBHandler) CreateContractsDataBatch(data []models.ContractsData) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return h.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(data, len(data)).Error
+}
+
+func (h *DBHandler) CreateContractsCodeBatch(data []models.ContractsCode) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return h.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(data, len(data)).Error
+}
+
+// CreateContractsTtlBatch upserts the TTLs on their key hash, so bootstrapping
+// again does not duplicate them.
+func (h *DBHandler) CreateContractsTtlBatch(data []models.ContractsTtl) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"live_until_ledger", "ledger"}),
+	}).CreateInBatches(data, len(data)).Error
+}
+
+// PruneContractsTtl deletes the TTLs written at ledger whose key hash is not
+// in keep. keep is staged in a temporary table, so it can be larger than
+// the number of parameters of a statement.
+func (h *DBHandler) PruneContractsTtl(ledger uint32, keep []string, batchSize int) error {
+	if err := h.db.Exec("CREATE TEMPORARY TABLE keep_ttls (key_hash text PRIMARY KEY) ON COMMIT DROP").Error; err != nil {
+		return err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(keep))
+	for _, keyHash := range keep {
+		rows = append(rows, map[string]interface{}{"key_hash": keyHash})
+	}
+	if len(rows) > 0 {
+		if err := h.db.Table("keep_ttls").CreateInBatches(rows, batchSize).Error; err != nil {
+			return err
+		}
+	}
+
+	return h.db.Exec(`
+DELETE FROM contracts_ttls AS t
+WHERE t.ledger = ?
+  AND NOT EXISTS (SELECT 1 FROM keep_ttls AS k WHERE k.key_hash = t.key_hash)`, ledger).Error
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// GetCursor returns the last ledger committed by the live ingestion of
+// network name, found is false when nothing was committed yet.
+func (h *DBHandler) GetCursor(name string) (uint32, bool, error) {
+	var cursor models.Cursor
+	err := h.db.Where("name = ?", name).First(&cursor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return cursor.Ledger, true, nil
+}
+
+// UpdateCursor moves the cursor of network name to ledger. Call it in the
+// transaction that commits the ledger.
+func (h *DBHandler) UpdateCursor(name string, ledger uint32) error {
+	cursor := models.Cursor{Name: name, Ledger: ledger}
+	return h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ledger"}),
+	}).Create(&cursor).Error
+}
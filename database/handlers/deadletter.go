@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// CreateDeadLetter records a record that failed to persist.
+func (h *DBHandler) CreateDeadLetter(data *models.DeadLetter) error {
+	return h.db.Create(data).Error
+}
+
+// GetDeadLetters returns the dead letters with the given ids, or all of
+// them when no id is given, oldest first.
+func (h *DBHandler) GetDeadLetters(ids ...uint64) ([]models.DeadLetter, error) {
+	query := h.db.Order("id ASC")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+
+	var deadLetters []models.DeadLetter
+	if err := query.Find(&deadLetters).Error; err != nil {
+		return nil, err
+	}
+
+	return deadLetters, nil
+}
+
+// UpdateDeadLetterError replaces the error of a dead letter after a failed retry.
+func (h *DBHandler) UpdateDeadLetterError(id uint64, errMsg string) error {
+	return h.db.Model(&models.DeadLetter{}).Where("id = ?", id).Update("error", errMsg).Error
+}
+
+// DeleteDeadLetter removes a dead letter once its record is persisted.
+func (h *DBHandler) DeleteDeadLetter(id uint64) error {
+	return h.db.Delete(&models.DeadLetter{}, id).Error
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// retryableClasses are the postgres error classes of failures that do not
+// depend on the rows: connection exception, transaction rollback such as
+// deadlocks and serialization failures, insufficient resources and operator
+// intervention such as a database shutting down.
+var retryableClasses = []string{"08", "40", "53", "57"}
+
+// IsRetryable reports whether a failed write may succeed if it is tried
+// again: lost connections and the postgres errors of retryableClasses.
+// Everything else, such as invalid data, violated constraints or a
+// mismatched schema, fails the same way every time.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		for _, class := range retryableClasses {
+			if strings.HasPrefix(pgErr.Code, class) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, driver.ErrBadConn)
+}
@@ -0,0 +1,45 @@
+package handlers_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/database/handlers"
+)
+
+func TestIsRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"wrapped net error", fmt.Errorf("connect: %w", &net.DNSError{Err: "timeout", IsTimeout: true}), true},
+		{"eof", fmt.Errorf("read: %w", io.EOF), true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"bad connection", fmt.Errorf("exec: %w", driver.ErrBadConn), true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", fmt.Errorf("commit: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"invalid input", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "22P02"}), false},
+		{"undefined column", &pgconn.PgError{Code: "42703"}, false},
+		{"short code", &pgconn.PgError{Code: "4"}, false},
+		{"empty code", &pgconn.PgError{}, false},
+		{"unknown error", errors.New("unknown"), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.retryable, handlers.IsRetryable(tc.err))
+		})
+	}
+}
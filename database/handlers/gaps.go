@@ -0,0 +1,48 @@
+package handlers
+
+// LedgerGap is a range of consecutive ledgers missing from the ledgers table
+type LedgerGap struct {
+	From uint32 `json:"from"`
+	To   uint32 `json:"to"`
+}
+
+// GetLedgerBounds returns the lowest and highest stored ledgers, found is
+// false when the ledgers table is empty.
+func (h *DBHandler) GetLedgerBounds() (uint32, uint32, bool, error) {
+	var bounds struct {
+		Lowest  uint32
+		Highest uint32
+	}
+	err := h.db.Raw("SELECT COALESCE(MIN(seq), 0) AS lowest, COALESCE(MAX(seq), 0) AS highest FROM ledgers").
+		Scan(&bounds).Error
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return bounds.Lowest, bounds.Highest, bounds.Highest != 0, nil
+}
+
+// GetLedgerGaps returns the ranges of ledgers [from, to] missing from the
+// ledgers table, in order. Each stored ledger is compared with the next one,
+// the bounds of the range count as stored so that missing ledgers at either
+// end are reported too.
+func (h *DBHandler) GetLedgerGaps(from, to uint32) ([]LedgerGap, error) {
+	var gaps []LedgerGap
+	err := h.db.Raw(`
+SELECT seq + 1 AS "from", next_seq - 1 AS "to"
+FROM (
+    SELECT seq, LEAD(seq) OVER (ORDER BY seq) AS next_seq
+    FROM (
+        SELECT seq FROM ledgers WHERE seq BETWEEN ? AND ?
+        UNION ALL SELECT CAST(? AS bigint) - 1
+        UNION ALL SELECT CAST(? AS bigint) + 1
+    ) AS s
+) AS l
+WHERE next_seq > seq + 1
+ORDER BY seq`, from, to, from, to).Scan(&gaps).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return gaps, nil
+}
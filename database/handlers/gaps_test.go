@@ -0,0 +1,42 @@
+package handlers_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+func TestGetLedgerGaps(t *testing.T) {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	h := handlers.NewDBHandler()
+
+	err := h.Transaction(func(h *handlers.DBHandler) error {
+		base := uint32(benchLedgerBase)
+		for _, seq := range []uint32{base + 3, base + 4, base + 7, base + 10} {
+			_, err := h.CreateLedger(&models.Ledger{Seq: seq})
+			require.NoError(t, err)
+		}
+
+		gaps, err := h.GetLedgerGaps(base+1, base+12)
+		require.NoError(t, err)
+		require.Equal(t, []handlers.LedgerGap{
+			{From: base + 1, To: base + 2},
+			{From: base + 5, To: base + 6},
+			{From: base + 8, To: base + 9},
+			{From: base + 11, To: base + 12},
+		}, gaps)
+
+		gaps, err = h.GetLedgerGaps(base+3, base+4)
+		require.NoError(t, err)
+		require.Empty(t, gaps)
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
@@ -3,11 +3,28 @@ package handlers
 import (
 	"fmt"
 
+	"gorm.io/gorm/clause"
+
 	"github.com/decentrio/soro-book/database/models"
 )
 
+// upsert inserts data, or updates the stored row with the same natural key
+// so that re-ingesting a ledger is harmless.
+func (h *DBHandler) upsert(data interface{}, keys ...string) error {
+	return h.db.Clauses(onConflictUpdateAll(keys...)).Create(data).Error
+}
+
+func onConflictUpdateAll(keys ...string) clause.OnConflict {
+	columns := make([]clause.Column, len(keys))
+	for i, key := range keys {
+		columns[i] = clause.Column{Name: key}
+	}
+
+	return clause.OnConflict{Columns: columns, UpdateAll: true}
+}
+
 func (h *DBHandler) CreateLedger(data *models.Ledger) (string, error) {
-	if err := h.db.Create(data).Error; err != nil {
+	if err := h.upsert(data, "seq"); err != nil {
 		return "", err
 	}
 
@@ -15,7 +32,7 @@ func (h *DBHandler) CreateLedger(data *models.Ledger) (string, error) {
 }
 
 func (h *DBHandler) CreateTransaction(data *models.Transaction) (string, error) {
-	if err := h.db.Create(data).Error; err != nil {
+	if err := h.upsert(data, "hash"); err != nil {
 		return "", err
 	}
 
@@ -23,7 +40,7 @@ func (h *DBHandler) CreateTransaction(data *models.Transaction) (string, error)
 }
 
 func (h *DBHandler) CreateContractCreatedTransaction(data *models.ContractsCode) (string, error) {
-	if err := h.db.Create(data).Error; err != nil {
+	if err := h.upsert(data, "contract_id"); err != nil {
 		return "", err
 	}
 
@@ -31,7 +48,7 @@ func (h *DBHandler) CreateContractCreatedTransaction(data *models.ContractsCode)
 }
 
 func (h *DBHandler) CreateContractInvokedTransaction(data *models.InvokeTransaction) (string, error) {
-	if err := h.db.Create(data).Error; err != nil {
+	if err := h.upsert(data, "hash"); err != nil {
 		return "", err
 	}
 
@@ -39,7 +56,7 @@ func (h *DBHandler) CreateContractInvokedTransaction(data *models.InvokeTransact
 }
 
 func (h *DBHandler) CreateWasmContractEvent(data *models.WasmContractEvent) (string, error) {
-	if err := h.db.Create(data).Error; err != nil {
+	if err := h.upsert(data, "id"); err != nil {
 		return "", err
 	}
 
@@ -47,7 +64,7 @@ func (h *DBHandler) CreateWasmContractEvent(data *models.WasmContractEvent) (str
 }
 
 func (h *DBHandler) CreateAssetContractTransferEvent(data *models.AssetContractTransferEvent) (string, error) {
-	if err := h.db.Create(data).Error; err != nil {
+	if err := h.upsert(data, "id"); err != nil {
 		return "", err
 	}
 
@@ -55,7 +72,7 @@ func (h *DBHandler) CreateAssetContractTransferEvent(data *models.AssetContractT
 }
 
 func (h *DBHandler) CreateAssetContractMintEvent(data *models.AssetContractMintEvent) (string, error) {
-	if err := h.db.Create(data).Error; err != nil {
+	if err := h.upsert(data, "id"); err != nil {
 		return "", err
 	}
 
@@ -63,7 +80,7 @@ func (h *DBHandler) CreateAssetContractMintEvent(data *models.AssetContractMintE
 }
 
 func (h *DBHandler) CreateAssetContractBurnEvent(data *models.AssetContractBurnEvent) (string, error) {
-	if err := h.db.Create(data).Error; err != nil {
+	if err := h.upsert(data, "id"); err != nil {
 		return "", err
 	}
 
@@ -71,14 +88,25 @@ func (h *DBHandler) CreateAssetContractBurnEvent(data *models.AssetContractBurnE
 }
 
 func (h *DBHandler) CreateAssetContractClawbackEvent(data *models.AssetContractClawbackEvent) (string, error) {
-	if err := h.db.Create(data).Error; err != nil {
+	if err := h.upsert(data, "id"); err != nil {
 		return "", err
 	}
 
 	return data.Id, nil
 }
 
+// CreateContractEntry stores a contract data entry and supersedes the
+// previous newest entry of its key. An entry that is already stored is
+// left as is, so re-ingesting a ledger does not supersede it.
 func (h *DBHandler) CreateContractEntry(data *models.ContractsData) (string, error) {
+	var count int64
+	if err := h.db.Model(&models.ContractsData{}).Where("id = ?", data.Id).Count(&count).Error; err != nil {
+		return "ERROR: find contract data entry", err
+	}
+	if count > 0 {
+		return fmt.Sprintf("%s: %s-%s", data.EntryType, data.ContractId, string(data.KeyXdr)), nil
+	}
+
 	switch data.EntryType {
 	case "updated":
 		var oldData models.ContractsData
@@ -87,7 +115,6 @@ func (h *DBHandler) CreateContractEntry(data *models.ContractsData) (string, err
 			Where("is_newest = ?", true).
 			Where("key_xdr = ?", data.KeyXdr).
 			First(&oldData).Error; err == nil {
-			fmt.Println("CreateContractEntry Updated")
 			oldData.IsNewest = false
 			oldData.UpdatedLedger = data.Ledger - 1
 			if err := h.db.Table("contracts_data").Save(oldData).Error; err != nil {
@@ -103,7 +130,6 @@ func (h *DBHandler) CreateContractEntry(data *models.ContractsData) (string, err
 			Where("is_newest = ?", true).
 			Where("key_xdr = ?", data.KeyXdr).
 			First(&oldData).Error; err == nil {
-			fmt.Println("CreateContractEntry Removed")
 			oldData.IsNewest = false
 			oldData.UpdatedLedger = data.Ledger - 1
 			if err := h.db.Table("contracts_data").Save(oldData).Error; err != nil {
@@ -1,37 +1,159 @@
 package handlers
 
 import (
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+
+	"github.com/decentrio/soro-book/database/models"
 )
 
+// DefaultConnectTimeout bounds how long connecting to the database is retried
+const DefaultConnectTimeout = 2 * time.Minute
+
 type DBHandler struct {
 	db *gorm.DB
 }
 
 func NewDBHandler() *DBHandler {
-	db := createConnection()
-	return &DBHandler{db: db}
-}
-
-// create connection with postgres db
-func createConnection() *gorm.DB {
 	sqlUrl, ok := os.LookupEnv("POSTGRES_URL")
 
 	if !ok {
 		log.Fatalf("Error get POSTGRES_URL")
 	}
 
-	// Open the connection
-	db, err := gorm.Open(postgres.Open(sqlUrl), &gorm.Config{})
+	return newDBHandler(sqlUrl)
+}
+
+// NewDBHandlerWithSchema connects to the database at sqlUrl, or POSTGRES_URL
+// when it is empty, and reads and writes the tables of schema.
+func NewDBHandlerWithSchema(sqlUrl string, schema string) *DBHandler {
+	if sqlUrl == "" {
+		var ok bool
+		sqlUrl, ok = os.LookupEnv("POSTGRES_URL")
+		if !ok {
+			log.Fatalf("Error get POSTGRES_URL")
+		}
+	}
+
+	if schema != "" {
+		var err error
+		sqlUrl, err = withSearchPath(sqlUrl, schema)
+		if err != nil {
+			log.Fatalf("Error set schema %s: %s", schema, err.Error())
+		}
+	}
+
+	return newDBHandler(sqlUrl)
+}
+
+// naturalKeys are the columns identifying a row of each table, writes are
+// upserts on them
+var naturalKeys = []struct {
+	table   string
+	columns string
+}{
+	{"ledgers", "seq"},
+	{"transactions", "hash"},
+	{"invoke_transactions", "hash"},
+	{"contracts_codes", "contract_id"},
+	{"contracts_data", "id"},
+	{"wasm_contract_events", "id"},
+	{"asset_contract_transfer_events", "id"},
+	{"asset_contract_mint_events", "id"},
+	{"asset_contract_burn_events", "id"},
+	{"asset_contract_clawback_events", "id"},
+}
+
+func newDBHandler(sqlUrl string) *DBHandler {
+	conn, err := createConnection(sqlUrl)
+	if err != nil {
+		log.Fatalf("Error connect database: %s", err.Error())
+	}
+
+	h := &DBHandler{db: conn}
+	if err := h.EnsureNaturalKeys(); err != nil {
+		log.Fatalf("Error create unique indexes, remove the duplicated rows first: %s", err.Error())
+	}
+	if err := h.Migrate(&models.Cursor{}); err != nil {
+		log.Fatalf("Error create cursors table: %s", err.Error())
+	}
+	if err := h.Migrate(&models.DeadLetter{}); err != nil {
+		log.Fatalf("Error create dead_letters table: %s", err.Error())
+	}
+
+	return h
+}
+
+// Close closes the database connections of the handler.
+func (h *DBHandler) Close() error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
+// EnsureNaturalKeys creates the unique indexes the upserts rely on.
+func (h *DBHandler) EnsureNaturalKeys() error {
+	for _, key := range naturalKeys {
+		err := h.db.Exec(fmt.Sprintf(
+			"CREATE UNIQUE INDEX IF NOT EXISTS %s_natural_key ON %s (%s)",
+			key.table, key.table, key.columns,
+		)).Error
+		if err != nil {
+			return fmt.Errorf("%s: %w", key.table, err)
+		}
+	}
+
+	return nil
+}
+
+// create connection with postgres db, the database may still be starting
+// so failures are retried with an exponential backoff
+func createConnection(sqlUrl string) (*gorm.DB, error) {
+	var db *gorm.DB
+	open := func() error {
+		var err error
+		db, err = gorm.Open(postgres.Open(sqlUrl), &gorm.Config{})
+		return err
+	}
+	retry := backoff.NewExponentialBackOff()
+	retry.MaxElapsedTime = DefaultConnectTimeout
+	err := backoff.RetryNotify(open, retry, func(err error, wait time.Duration) {
+		log.Printf("Error connect database, retry in %s: %s", wait, err.Error())
+	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	log.Println("Connected to MySQL:", db)
 
-	return db
+	return db, nil
+}
+
+// withSearchPath sets the search_path of the connections opened with dsn,
+// either a postgres:// url or a key=value connection string.
+func withSearchPath(dsn string, schema string) (string, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return fmt.Sprintf("%s search_path=%s", dsn, schema), nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
 }
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// Transaction runs fn inside a database transaction. The handler passed to
+// fn writes through that transaction, which is committed when fn returns nil
+// and rolled back otherwise.
+func (h *DBHandler) Transaction(fn func(h *DBHandler) error) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&DBHandler{db: tx})
+	})
+}
+
+// GetTransactions returns the transactions of ledgers [from, to] in
+// ledger and application order.
+func (h *DBHandler) GetTransactions(from, to uint32) ([]models.Transaction, error) {
+	var txs []models.Transaction
+	err := h.db.
+		Where("ledger BETWEEN ? AND ?", from, to).
+		Order("ledger ASC").
+		Order("application_order ASC").
+		Find(&txs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return txs, nil
+}
+
+// GetContractData returns the contract data entries of contractId in ledger
+// order.
+func (h *DBHandler) GetContractData(contractId string) ([]models.ContractsData, error) {
+	var entries []models.ContractsData
+	err := h.db.
+		Where("contract_id = ?", contractId).
+		Order("ledger ASC").
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// DeleteDerivedData removes the records that are derived from the stored
+// transactions of ledgers [from, to]: invocations, created contracts,
+// contract data entries and contract events. The entries seeded from a
+// checkpoint are not derived from any transaction and are kept, and so are
+// the contracts of their instances.
+func (h *DBHandler) DeleteDerivedData(from, to uint32) error {
+	txHashes := h.db.Model(&models.Transaction{}).
+		Select("hash").
+		Where("ledger BETWEEN ? AND ?", from, to)
+	checkpointContracts := h.db.Model(&models.ContractsData{}).
+		Select("contract_id").
+		Where("entry_type = ?", EntryTypeCheckpoint)
+
+	deletes := []*gorm.DB{
+		h.db.Where("hash IN (?)", txHashes).Delete(&models.InvokeTransaction{}),
+		h.db.Where("created_ledger BETWEEN ? AND ?", from, to).
+			Where("contract_id NOT IN (?)", checkpointContracts).
+			Delete(&models.ContractsCode{}),
+		h.db.Where("tx_hash IN (?)", txHashes).
+			Where("entry_type <> ?", EntryTypeCheckpoint).
+			Delete(&models.ContractsData{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.WasmContractEvent{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.AssetContractTransferEvent{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.AssetContractMintEvent{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.AssetContractBurnEvent{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.AssetContractClawbackEvent{}),
+	}
+	for _, d := range deletes {
+		if d.Error != nil {
+			return d.Error
+		}
+	}
+
+	return nil
+}
+
+// RestoreNewestContractData marks as newest again the contract data entries
+// written before ledger from that were superseded by an entry of ledgers
+// [from, to]. It must run after those entries are deleted.
+func (h *DBHandler) RestoreNewestContractData(from, to uint32) error {
+	return h.db.Table("contracts_data").
+		Where("ledger < ?", from).
+		Where("is_newest = ?", false).
+		Where("updated_ledger BETWEEN ? AND ?", int64(from)-1, int64(to)-1).
+		Updates(map[string]interface{}{
+			"is_newest":      true,
+			"updated_ledger": uint32(math.MaxInt32),
+		}).Error
+}
+
+// StageContractDataKeys keeps the keys of the contract data entries of
+// ledgers [from, to] in a temporary table until the database transaction
+// ends, so RecomputeStagedContractData still covers them once their entries
+// are deleted. Run both in the same transaction.
+func (h *DBHandler) StageContractDataKeys(from, to uint32) error {
+	err := h.db.Exec(`
+CREATE TEMPORARY TABLE IF NOT EXISTS staged_keys (
+    contract_id text,
+    key_xdr bytea
+) ON COMMIT DROP`).Error
+	if err != nil {
+		return err
+	}
+
+	return h.db.Exec(`
+INSERT INTO staged_keys (contract_id, key_xdr)
+SELECT DISTINCT contract_id, key_xdr FROM contracts_data WHERE ledger BETWEEN ? AND ?`, from, to).Error
+}
+
+// RecomputeStagedContractData sets is_newest and updated_ledger again for
+// every entry of the staged keys and of the keys that have an entry in
+// ledgers [from, to].
+func (h *DBHandler) RecomputeStagedContractData(from, to uint32) error {
+	if err := h.StageContractDataKeys(from, to); err != nil {
+		return err
+	}
+
+	return h.recomputeNewestContractData("SELECT contract_id, key_xdr FROM staged_keys")
+}
+
+// RecomputeNewestContractData sets is_newest and updated_ledger again for
+// every entry of the keys that have an entry in ledgers [from, to], from the
+// ledger and application order of the entries. Run it after ledgers were
+// written out of order, e.g. when a gap is filled, since writes only
+// supersede the newest entry stored at that time.
+func (h *DBHandler) RecomputeNewestContractData(from, to uint32) error {
+	return h.recomputeNewestContractData("SELECT contract_id, key_xdr FROM contracts_data WHERE ledger BETWEEN ? AND ?", from, to)
+}
+
+// recomputeNewestContractData recomputes the entries of the keys selected
+// by the query keys.
+func (h *DBHandler) recomputeNewestContractData(keys string, args ...interface{}) error {
+	query := fmt.Sprintf(`
+UPDATE contracts_data AS c
+SET is_newest = n.next_ledger IS NULL,
+    updated_ledger = COALESCE(n.next_ledger - 1, ?)
+FROM (
+    SELECT d.id, LEAD(d.ledger) OVER (
+        PARTITION BY d.contract_id, d.key_xdr
+        ORDER BY d.ledger, t.application_order NULLS FIRST
+    ) AS next_ledger
+    FROM contracts_data AS d
+    LEFT JOIN transactions AS t ON t.hash = d.tx_hash
+    WHERE (d.contract_id, d.key_xdr) IN (%s)
+) AS n
+WHERE c.id = n.id`, keys)
+
+	args = append([]interface{}{uint32(math.MaxInt32)}, args...)
+	return h.Transaction(func(h *DBHandler) error {
+		// the live ingestion may supersede entries of the same keys meanwhile,
+		// its writes wait for the recompute
+		if err := h.db.Exec("LOCK TABLE contracts_data IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+		return h.db.Exec(query, args...).Error
+	})
+}
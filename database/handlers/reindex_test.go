@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+func testContractData(name string, contractId string, ledger uint32, entryType string) models.ContractsData {
+	return models.ContractsData{
+		Id:            uuid.NewSHA1(uuid.NameSpaceOID, []byte(name)).String(),
+		ContractId:    contractId,
+		Ledger:        ledger,
+		EntryType:     entryType,
+		KeyXdr:        []byte("key"),
+		IsNewest:      true,
+		UpdatedLedger: math.MaxInt32,
+	}
+}
+
+// TestRecomputeNewestContractData writes two backfill chunks that update
+// the same key, the later chunk first.
+func TestRecomputeNewestContractData(t *testing.T) {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	h := handlers.NewDBHandler()
+
+	err := h.Transaction(func(h *handlers.DBHandler) error {
+		base := uint32(benchLedgerBase)
+		contractId := "CRECOMPUTETEST"
+
+		second := handlers.Batch{ContractsData: []models.ContractsData{
+			testContractData("recompute-3", contractId, base+3, "updated"),
+		}}
+		require.NoError(t, h.WriteBatch(&second, 1000))
+		first := handlers.Batch{ContractsData: []models.ContractsData{
+			testContractData("recompute-1", contractId, base+1, "created"),
+			testContractData("recompute-2", contractId, base+2, "updated"),
+		}}
+		require.NoError(t, h.WriteBatch(&first, 1000))
+
+		require.NoError(t, h.RecomputeNewestContractData(base+1, base+4))
+
+		entries, err := h.GetContractData(contractId)
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+		for i, want := range []struct {
+			isNewest      bool
+			updatedLedger uint32
+		}{
+			{false, base + 1},
+			{false, base + 2},
+			{true, math.MaxInt32},
+		} {
+			require.Equal(t, want.isNewest, entries[i].IsNewest, "entry of ledger %d", entries[i].Ledger)
+			require.Equal(t, want.updatedLedger, entries[i].UpdatedLedger, "entry of ledger %d", entries[i].Ledger)
+		}
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"math"
+
+	"gorm.io/gorm"
+
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// Rollback deletes everything indexed above ledger to in a single database
+// transaction: the ledgers, their transactions and every record derived
+// from them. The contract data entries that were the newest at ledger to
+// are marked as newest again and the cursor cursorName is moved back to
+// ledger to. It returns the number of deleted ledgers.
+func (h *DBHandler) Rollback(cursorName string, to uint32) (int64, error) {
+	var deleted int64
+	err := h.Transaction(func(h *DBHandler) error {
+		var err error
+		if deleted, err = h.DeleteAbove(to); err != nil {
+			return err
+		}
+		if err := h.RestoreNewestContractData(to+1, math.MaxInt32); err != nil {
+			return err
+		}
+
+		return h.ResetCursor(cursorName, to)
+	})
+
+	return deleted, err
+}
+
+// DeleteAbove removes the ledgers above ledger to, their transactions, the
+// records derived from them and their dead letters. It returns the number
+// of deleted ledgers.
+func (h *DBHandler) DeleteAbove(to uint32) (int64, error) {
+	txHashes := h.db.Model(&models.Transaction{}).
+		Select("hash").
+		Where("ledger > ?", to)
+
+	// derived records first, they are matched by the hashes of the
+	// transactions deleted last
+	deletes := []*gorm.DB{
+		h.db.Where("hash IN (?)", txHashes).Delete(&models.InvokeTransaction{}),
+		h.db.Where("created_ledger > ?", to).Delete(&models.ContractsCode{}),
+		h.db.Where("ledger > ?", to).Delete(&models.ContractsData{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.WasmContractEvent{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.AssetContractTransferEvent{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.AssetContractMintEvent{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.AssetContractBurnEvent{}),
+		h.db.Where("tx_hash IN (?)", txHashes).Delete(&models.AssetContractClawbackEvent{}),
+		h.db.Where("ledger > ?", to).Delete(&models.DeadLetter{}),
+		h.db.Where("ledger > ?", to).Delete(&models.Transaction{}),
+	}
+	// only bootstrapped databases have ttls
+	if h.db.Migrator().HasTable(&models.ContractsTtl{}) {
+		deletes = append(deletes, h.db.Where("ledger > ?", to).Delete(&models.ContractsTtl{}))
+	}
+	for _, d := range deletes {
+		if d.Error != nil {
+			return 0, d.Error
+		}
+	}
+
+	ledgers := h.db.Where("seq > ?", to).Delete(&models.Ledger{})
+	if ledgers.Error != nil {
+		return 0, ledgers.Error
+	}
+
+	return ledgers.RowsAffected, nil
+}
+
+// ResetCursor moves the cursor name back to ledger to when it is above it,
+// ingestion resumes right after it.
+func (h *DBHandler) ResetCursor(name string, to uint32) error {
+	return h.db.Model(&models.Cursor{}).
+		Where("name = ?", name).
+		Where("ledger > ?", to).
+		Update("ledger", to).Error
+}
@@ -0,0 +1,94 @@
+package handlers_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/database/models"
+)
+
+func TestRollback(t *testing.T) {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	h := handlers.NewDBHandler()
+
+	err := h.Transaction(func(h *handlers.DBHandler) error {
+		base := uint32(benchLedgerBase)
+		for _, seq := range []uint32{base + 1, base + 2, base + 3} {
+			_, err := h.CreateLedger(&models.Ledger{Seq: seq})
+			require.NoError(t, err)
+			_, err = h.CreateTransaction(&models.Transaction{
+				Hash:   fmt.Sprintf("rollback-%d", seq),
+				Ledger: seq,
+			})
+			require.NoError(t, err)
+		}
+		require.NoError(t, h.UpdateCursor("rollback-test", base+3))
+		// already below the ledger rolled back to
+		require.NoError(t, h.UpdateCursor("rollback-test-behind", base))
+		// the cursor of another network
+		require.NoError(t, h.UpdateCursor("rollback-test-other", base+3))
+
+		deleted, err := h.Rollback("rollback-test", base+1)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), deleted)
+
+		ledgers, err := h.GetLedgers(base+1, base+3)
+		require.NoError(t, err)
+		require.Len(t, ledgers, 1)
+		require.Equal(t, base+1, ledgers[0].Seq)
+
+		txs, err := h.GetTransactions(base+1, base+3)
+		require.NoError(t, err)
+		require.Len(t, txs, 1)
+
+		cursor, found, err := h.GetCursor("rollback-test")
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, base+1, cursor)
+
+		cursor, _, err = h.GetCursor("rollback-test-behind")
+		require.NoError(t, err)
+		require.Equal(t, base, cursor)
+
+		cursor, _, err = h.GetCursor("rollback-test-other")
+		require.NoError(t, err)
+		require.Equal(t, base+3, cursor)
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
+
+func TestResetCursor(t *testing.T) {
+	if _, ok := os.LookupEnv("POSTGRES_URL"); !ok {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	h := handlers.NewDBHandler()
+
+	err := h.Transaction(func(h *handlers.DBHandler) error {
+		base := uint32(benchLedgerBase)
+		require.NoError(t, h.UpdateCursor("reset-test", base))
+
+		// a cursor below the ledger is left unchanged
+		require.NoError(t, h.ResetCursor("reset-test", base+1))
+		cursor, found, err := h.GetCursor("reset-test")
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, base, cursor)
+
+		// a missing cursor is not created
+		require.NoError(t, h.ResetCursor("reset-test-missing", base))
+		_, found, err = h.GetCursor("reset-test-missing")
+		require.NoError(t, err)
+		require.False(t, found)
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
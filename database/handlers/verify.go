@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"github.com/decentrio/soro-book/database/models"
+)
+
+// GetLedgers returns the stored ledgers of [from, to] in sequence order.
+func (h *DBHandler) GetLedgers(from, to uint32) ([]models.Ledger, error) {
+	var ledgers []models.Ledger
+	err := h.db.
+		Where("seq BETWEEN ? AND ?", from, to).
+		Order("seq ASC").
+		Find(&ledgers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return ledgers, nil
+}
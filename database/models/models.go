@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stellar/go/xdr"
@@ -63,6 +64,37 @@ type ContractsData struct {
 	UpdatedLedger uint32 `json:"updated_ledger,omitempty"` // previous updated ledger (TODO: we should correct the name here)
 }
 
+// Cursor is the last ledger fully committed by the live ingestion of a network
+type Cursor struct {
+	Name   string `json:"name,omitempty" gorm:"primaryKey"`
+	Ledger uint32 `json:"ledger,omitempty"`
+}
+
+// DeadLetter is a record of a transaction that failed to persist. It keeps
+// the raw XDR of the transaction so the record can be decoded and written
+// again once the cause is fixed. ModelType is the table of the record.
+type DeadLetter struct {
+	Id               uint64    `json:"id,omitempty" gorm:"primaryKey;autoIncrement"`
+	Ledger           uint32    `json:"ledger,omitempty"`
+	TxHash           string    `json:"tx_hash,omitempty"`
+	ApplicationOrder uint32    `json:"application_order,omitempty"`
+	TransactionTime  uint64    `json:"transaction_time,omitempty"`
+	ModelType        string    `json:"model_type,omitempty"`
+	EnvelopeXdr      []byte    `json:"envelope_xdr,omitempty"`
+	ResultXdr        []byte    `json:"result_xdr,omitempty"`
+	ResultMetaXdr    []byte    `json:"result_meta_xdr,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	CreatedAt        time.Time `json:"created_at,omitempty"`
+}
+
+// ContractsTtl is the live until ledger of a contract data or contract code
+// entry, identified by the sha256 hash of its ledger key
+type ContractsTtl struct {
+	KeyHash         string `json:"key_hash,omitempty" gorm:"uniqueIndex"`
+	LiveUntilLedger uint32 `json:"live_until_ledger,omitempty"`
+	Ledger          uint32 `json:"ledger,omitempty"`
+}
+
 type Int128Parts struct {
 	Hi int64  `json:"hi,omitempty"`
 	Lo uint64 `json:"lo,omitempty"`
@@ -12,13 +12,39 @@ import (
 )
 
 const (
-	HomeFlag      = "home"
-	TraceFlag     = "trace"
-	OutputFlag    = "output"
-	StartLedger   = "start"
-	CurrentLedger = "curr"
-	Mode          = "mode"
-	NetWork       = "network"
+	HomeFlag           = "home"
+	TraceFlag          = "trace"
+	OutputFlag         = "output"
+	StartLedger        = "start"
+	Mode               = "mode"
+	NetWork            = "network"
+	Backend            = "backend"
+	Backends           = "backends"
+	LedgerDir          = "ledger-dir"
+	RPCURL             = "rpc-url"
+	ArchiveDir         = "archive-dir"
+	NetworkPassphrase  = "network-passphrase"
+	HistoryArchiveURLs = "history-archive-urls"
+	CaptiveCoreConfig  = "captive-core-config"
+	CoreStoragePath    = "core-storage-path"
+	CoreLogLevel       = "core-log-level"
+	QueueSize          = "queue-size"
+	DecodeWorkers      = "decode-workers"
+	FlushSize          = "flush-size"
+	FlushInterval      = "flush-interval"
+	ShutdownTimeout    = "shutdown-timeout"
+	RetryTimeout       = "retry-timeout"
+	GapScanInterval    = "gap-scan-interval"
+	Repair             = "repair"
+	SkipVerify         = "skip-verify"
+	Bootstrap          = "bootstrap"
+	Contracts          = "contracts"
+	ExcludeContracts   = "exclude-contracts"
+	Accounts           = "accounts"
+	FromLedger         = "from"
+	ToLedger           = "to"
+	Workers            = "workers"
+	ChunkCheckpoints   = "chunk-checkpoints"
 )
 
 // Executable is the minimal interface to *corba.Command, so we can
@@ -32,8 +58,29 @@ func PrepareBaseCmd(cmd *cobra.Command, envPrefix, defaultHome string) Executor
 	cmd.PersistentFlags().StringP(HomeFlag, "", defaultHome, "directory for config and data")
 	cmd.PersistentFlags().Bool(TraceFlag, true, "print out full stack trace on errors")
 	cmd.PersistentFlags().Uint32(StartLedger, 0, "starting ledger")
-	cmd.PersistentFlags().Uint32(CurrentLedger, 0, "current ledger")
-	cmd.PersistentFlags().String(NetWork, "pubnet", "running network pubnet/testnet")
+	cmd.PersistentFlags().String(NetWork, "pubnet", "running network pubnet/testnet/futurenet/standalone or a custom network name")
+	cmd.PersistentFlags().String(NetworkPassphrase, "", "network passphrase of a custom network")
+	cmd.PersistentFlags().StringSlice(HistoryArchiveURLs, nil, "history archive urls of a custom network")
+	cmd.PersistentFlags().String(CaptiveCoreConfig, "", "captive core toml used instead of the embedded pubnet/testnet config")
+	cmd.PersistentFlags().String(CoreStoragePath, "", "directory where captive core keeps its buckets and database")
+	cmd.PersistentFlags().String(CoreLogLevel, "info", "level of the stellar-core logs debug/info/warn/error")
+	cmd.PersistentFlags().String(Backend, "captive-core", "ledger backend captive-core/file/rpc/archive")
+	cmd.PersistentFlags().StringSlice(Backends, nil, "ordered ledger backends to fail over between, overrides --backend")
+	cmd.PersistentFlags().String(LedgerDir, "", "directory of ledger exporter files for the file backend")
+	cmd.PersistentFlags().String(RPCURL, "", "stellar rpc url for the rpc backend and the network tip")
+	cmd.PersistentFlags().String(ArchiveDir, "", "directory where raw ledgers are archived, also read by the archive backend")
+	cmd.PersistentFlags().Uint32(QueueSize, 256, "ledgers fetched ahead of the last committed one")
+	cmd.PersistentFlags().Uint32(DecodeWorkers, 4, "ledgers decoded in parallel")
+	cmd.PersistentFlags().Uint32(FlushSize, 5000, "rows buffered before they are written to the database")
+	cmd.PersistentFlags().Uint32(FlushInterval, 1000, "milliseconds rows stay buffered at most")
+	cmd.PersistentFlags().Uint32(ShutdownTimeout, 30, "seconds stopping waits for fetched ledgers to be committed")
+	cmd.PersistentFlags().Uint32(RetryTimeout, 300, "seconds a failing fetch or write is retried before ingestion halts")
+	cmd.PersistentFlags().Uint32(GapScanInterval, 0, "seconds between scans for missing ledgers repaired in the background, 0 disables it")
+	cmd.PersistentFlags().Bool(SkipVerify, false, "do not verify the hashes of ingested ledgers")
+	cmd.PersistentFlags().Bool(Bootstrap, false, "seed contract state from the checkpoint at or before --start before ingesting")
+	cmd.PersistentFlags().StringSlice(Contracts, nil, "only persist records of these contract ids")
+	cmd.PersistentFlags().StringSlice(ExcludeContracts, nil, "never persist records of these contract ids")
+	cmd.PersistentFlags().StringSlice(Accounts, nil, "only persist contract records tied to these account addresses")
 	cmd.PersistentPreRunE = concatCobraCmdFuncs(bindFlagsLoadViper, cmd.PersistentPreRunE)
 	return Executor{cmd, os.Exit}
 }
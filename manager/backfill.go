@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/stellar/go/support/log"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/config"
+	db "github.com/decentrio/soro-book/database/handlers"
+)
+
+const (
+	DefaultBackfillWorkers             = 1
+	DefaultBackfillCheckpointsPerChunk = 64
+)
+
+// BackfillChunk is a checkpoint aligned part of a backfill range.
+type BackfillChunk struct {
+	From uint32 `json:"from"`
+	To   uint32 `json:"to"`
+	Done bool   `json:"done"`
+}
+
+// BackfillProgress is persisted after every finished chunk so an
+// interrupted backfill only re-runs the unfinished chunks.
+type BackfillProgress struct {
+	From   uint32          `json:"from"`
+	To     uint32          `json:"to"`
+	Chunks []BackfillChunk `json:"chunks"`
+}
+
+// SplitCheckpointRange splits [from, to] into chunks of checkpointsPerChunk
+// checkpoints of checkpointFrequency ledgers. Every chunk but the last ends
+// on a checkpoint ledger, so each backend replays from the checkpoint it
+// starts on.
+func SplitCheckpointRange(from, to, checkpointsPerChunk, checkpointFrequency uint32) []BackfillChunk {
+	if checkpointsPerChunk == 0 {
+		checkpointsPerChunk = DefaultBackfillCheckpointsPerChunk
+	}
+	size := checkpointsPerChunk * checkpointFrequency
+
+	var chunks []BackfillChunk
+	for start := from; start <= to; {
+		end := (start/size+1)*size - 1
+		if end > to {
+			end = to
+		}
+		chunks = append(chunks, BackfillChunk{From: start, To: end})
+		if end == to {
+			break
+		}
+		start = end + 1
+	}
+
+	return chunks
+}
+
+// Backfill ingests a closed ledger range with several aggregations running
+// in parallel, each one with its own ledger backend.
+type Backfill struct {
+	Logger *log.Entry
+
+	cfg          *config.AggregationConfig
+	db           *db.DBHandler
+	progressFile string
+	workers      int
+
+	mtx      sync.Mutex
+	progress BackfillProgress
+	stats    aggregation.Stats
+}
+
+// NewBackfill returns the backfill of [from, to] of the network of cfg, whose
+// ledgers are written to h. Its progress is saved to progressFile.
+func NewBackfill(
+	cfg *config.AggregationConfig,
+	h *db.DBHandler,
+	progressFile string,
+	from, to uint32,
+	workers int,
+	checkpointsPerChunk uint32,
+) *Backfill {
+	if workers <= 0 {
+		workers = DefaultBackfillWorkers
+	}
+
+	b := &Backfill{
+		Logger:       log.New().WithField("module", "backfill"),
+		cfg:          cfg,
+		db:           h,
+		progressFile: progressFile,
+		workers:      workers,
+		progress: BackfillProgress{
+			From:   from,
+			To:     to,
+			Chunks: SplitCheckpointRange(from, to, checkpointsPerChunk, aggregation.CheckpointFrequency(*cfg)),
+		},
+	}
+
+	// resume a previous run of the same range
+	if config.FileExists(progressFile) {
+		var progress BackfillProgress
+		bz, err := os.ReadFile(progressFile)
+		if err == nil && json.Unmarshal(bz, &progress) == nil &&
+			progress.From == from && progress.To == to {
+			b.progress = progress
+		}
+	}
+
+	return b
+}
+
+// Progress returns the chunks of the backfill and whether they are done.
+func (b *Backfill) Progress() BackfillProgress {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.progress
+}
+
+// Run ingests the unfinished chunks, workers at a time, until none is left
+// or stop is closed. A worker whose chunk fails exits and the chunk stays
+// unfinished for the next run. The chunks share the database handler of
+// the backfill.
+func (b *Backfill) Run(stop <-chan struct{}) (aggregation.Stats, error) {
+	chunks := make(chan int)
+	finished := make(chan struct{})
+	go func() {
+		defer close(chunks)
+		for i, chunk := range b.progress.Chunks {
+			if chunk.Done {
+				continue
+			}
+			select {
+			case chunks <- i:
+			case <-stop:
+				return
+			case <-finished:
+				return
+			}
+		}
+	}()
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, b.workers)
+	)
+	for w := 0; w < b.workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range chunks {
+				if err := b.runChunk(i, stop); err != nil {
+					errs[w] = err
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(finished)
+
+	if err := errors.Join(errs...); err != nil {
+		return b.stats, err
+	}
+	for _, chunk := range b.progress.Chunks {
+		if !chunk.Done {
+			return b.stats, nil
+		}
+	}
+
+	// chunks are committed out of order, each one superseded the contract
+	// data entries stored when it was written
+	if err := b.db.RecomputeNewestContractData(b.progress.From, b.progress.To); err != nil {
+		return b.stats, fmt.Errorf("error recompute newest contract data of [%d, %d]: %w", b.progress.From, b.progress.To, err)
+	}
+
+	return b.stats, nil
+}
+
+func (b *Backfill) runChunk(i int, stop <-chan struct{}) error {
+	chunk := b.progress.Chunks[i]
+	b.Logger.Infof("backfill chunk [%d, %d]", chunk.From, chunk.To)
+
+	asConfig := *b.cfg
+	asConfig.StartLedgerHeight = chunk.From
+	asConfig.EndLedgerHeight = chunk.To
+	asConfig.Bootstrap = false
+	as := aggregation.NewAggregation(&asConfig, aggregation.WithDBHandler(b.db))
+
+	if err := as.Start(); err != nil {
+		return err
+	}
+
+	var err error
+	select {
+	case <-as.Done():
+		err = as.Err()
+	case <-stop:
+		err = fmt.Errorf("backfill interrupted in chunk [%d, %d], last committed ledger %d", chunk.From, chunk.To, as.LastCommittedLedger())
+	}
+
+	as.Stop()
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	stats := as.Stats()
+	b.stats.Ledgers += stats.Ledgers
+	b.stats.Transactions += stats.Transactions
+	b.stats.Events += stats.Events
+
+	if err != nil {
+		return err
+	}
+
+	b.progress.Chunks[i].Done = true
+	return b.saveProgress()
+}
+
+func (b *Backfill) saveProgress() error {
+	bz, err := json.Marshal(b.progress)
+	if err != nil {
+		return err
+	}
+
+	return config.WriteState(b.progressFile, bz, 0o777)
+}
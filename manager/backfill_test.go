@@ -0,0 +1,33 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/manager"
+)
+
+func TestSplitCheckpointRange(t *testing.T) {
+	chunks := manager.SplitCheckpointRange(100, 400, 2, 64)
+	require.Equal(t, []manager.BackfillChunk{
+		{From: 100, To: 127},
+		{From: 128, To: 255},
+		{From: 256, To: 383},
+		{From: 384, To: 400},
+	}, chunks)
+
+	chunks = manager.SplitCheckpointRange(128, 255, 2, 64)
+	require.Equal(t, []manager.BackfillChunk{{From: 128, To: 255}}, chunks)
+
+	chunks = manager.SplitCheckpointRange(10, 10, 1, 64)
+	require.Equal(t, []manager.BackfillChunk{{From: 10, To: 10}}, chunks)
+
+	// a standalone network with checkpoints every 8 ledgers
+	chunks = manager.SplitCheckpointRange(10, 40, 2, 8)
+	require.Equal(t, []manager.BackfillChunk{
+		{From: 10, To: 15},
+		{From: 16, To: 31},
+		{From: 32, To: 40},
+	}, chunks)
+}
@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/stellar/go/support/log"
+
+	"github.com/decentrio/soro-book/aggregation"
+	"github.com/decentrio/soro-book/config"
+	db "github.com/decentrio/soro-book/database/handlers"
+	"github.com/decentrio/soro-book/lib/service"
+)
+
+// RepairGaps ingests the missing ledger ranges one after the other, each
+// with a bounded aggregation, until all are written or stop is closed.
+func RepairGaps(cfg config.AggregationConfig, h *db.DBHandler, gaps []db.LedgerGap, stop <-chan struct{}) (aggregation.Stats, error) {
+	var stats aggregation.Stats
+	for _, gap := range gaps {
+		asConfig := cfg
+		asConfig.StartLedgerHeight = gap.From
+		asConfig.EndLedgerHeight = gap.To
+		asConfig.Bootstrap = false
+		asConfig.GapScanInterval = 0
+		// the live captive core keeps its own storage
+		if asConfig.CoreStoragePath != "" {
+			asConfig.CoreStoragePath = filepath.Join(asConfig.CoreStoragePath, "repair")
+		}
+		as := aggregation.NewAggregation(&asConfig, aggregation.WithDBHandler(h))
+
+		if err := as.Start(); err != nil {
+			return stats, err
+		}
+
+		var err error
+		select {
+		case <-as.Done():
+			err = as.Err()
+		case <-stop:
+			err = fmt.Errorf("repair interrupted in gap [%d, %d], last committed ledger %d", gap.From, gap.To, as.LastCommittedLedger())
+		}
+
+		as.Stop()
+
+		s := as.Stats()
+		stats.Ledgers += s.Ledgers
+		stats.Transactions += s.Transactions
+		stats.Events += s.Events
+
+		if err != nil {
+			return stats, err
+		}
+
+		// the gap is older than the entries written after it
+		if err := h.RecomputeNewestContractData(gap.From, gap.To); err != nil {
+			return stats, fmt.Errorf("error recompute newest contract data of gap [%d, %d]: %w", gap.From, gap.To, err)
+		}
+	}
+
+	return stats, nil
+}
+
+// GapScanner periodically looks for ledgers missing below the cursor of a
+// network and ingests them again.
+type GapScanner struct {
+	service.BaseService
+
+	cfg      *config.AggregationConfig
+	db       *db.DBHandler
+	interval time.Duration
+}
+
+func NewGapScanner(cfg *config.AggregationConfig, h *db.DBHandler) *GapScanner {
+	g := &GapScanner{
+		cfg:      cfg,
+		db:       h,
+		interval: time.Duration(cfg.GapScanInterval) * time.Second,
+	}
+
+	g.BaseService = *service.NewBaseService("GapScanner", g)
+	g.BaseService.SetLogger(log.New().WithField("module", "gaps").WithField("network", cfg.Network))
+
+	return g
+}
+
+func (g *GapScanner) OnStart() error {
+	g.Logger.Info("Start")
+	go g.scanning()
+	return nil
+}
+
+func (g *GapScanner) OnStop() error {
+	g.Logger.Info("Stop")
+	return nil
+}
+
+func (g *GapScanner) scanning() {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			g.scan()
+		// Terminate process
+		case <-g.Terminate():
+			return
+		}
+	}
+}
+
+// scan repairs the gaps between the lowest stored ledger and the cursor,
+// the ledgers above the cursor are still being ingested.
+func (g *GapScanner) scan() {
+	cursor, found, err := g.db.GetCursor(aggregation.CursorName(g.cfg))
+	if err != nil {
+		g.Logger.Error(fmt.Sprintf("Error get cursor: %s", err.Error()))
+		return
+	}
+	if !found {
+		return
+	}
+	lowest, _, found, err := g.db.GetLedgerBounds()
+	if err != nil {
+		g.Logger.Error(fmt.Sprintf("Error get ledger bounds: %s", err.Error()))
+		return
+	}
+	if !found || lowest > cursor {
+		return
+	}
+
+	gaps, err := g.db.GetLedgerGaps(lowest, cursor)
+	if err != nil {
+		g.Logger.Error(fmt.Sprintf("Error get ledger gaps: %s", err.Error()))
+		return
+	}
+	if len(gaps) == 0 {
+		return
+	}
+
+	for _, gap := range gaps {
+		g.Logger.Infof("missing ledgers [%d, %d]", gap.From, gap.To)
+	}
+	stats, err := RepairGaps(*g.cfg, g.db, gaps, g.Terminate())
+	if err != nil {
+		g.Logger.Error(fmt.Sprintf("Error repair gaps: %s", err.Error()))
+		return
+	}
+	g.Logger.Infof("repaired %d gaps: %d ledgers, %d transactions, %d events", len(gaps), stats.Ledgers, stats.Transactions, stats.Events)
+}
@@ -3,7 +3,7 @@ package manager
 import (
 	"encoding/json"
 	"fmt"
-	"time"
+	"sync"
 
 	"github.com/decentrio/soro-book/aggregation"
 	"github.com/decentrio/soro-book/config"
@@ -18,13 +18,24 @@ type Manager struct {
 	// config of Manager
 	cfg *config.ManagerConfig
 
-	// aggregation services
-	as *aggregation.Aggregation
+	// aggregation services, one per network
+	networks []Network
+
+	// halted is closed when the ingestion of a network halts
+	halted   chan struct{}
+	haltOnce sync.Once
+	err      error
 }
 
-const (
-	PaddingLedger = 2560
-)
+// Network is an aggregation service and the file its config and cursor are
+// saved to on stop. Gaps repairs the ledgers missing below the cursor, it is
+// nil when the scanner is disabled.
+type Network struct {
+	Name      string
+	As        *aggregation.Aggregation
+	Gaps      *GapScanner
+	StateFile string
+}
 
 // StateOption sets an optional parameter on the State.
 type ManagerOption func(*Manager)
@@ -32,12 +43,13 @@ type ManagerOption func(*Manager)
 // NewBaseService creates a new manager.
 func NewManager(
 	cfg *config.ManagerConfig,
-	as *aggregation.Aggregation,
+	networks []Network,
 	options ...ManagerOption,
 ) *Manager {
 	m := &Manager{
-		cfg: cfg,
-		as:  as,
+		cfg:      cfg,
+		networks: networks,
+		halted:   make(chan struct{}),
 	}
 
 	m.BaseService = *service.NewBaseService("Manager", m)
@@ -52,28 +64,98 @@ func NewManager(
 
 func (m *Manager) OnStart() error {
 	m.Logger.Info("Start")
-	m.as.Start()
+	for _, n := range m.networks {
+		if err := n.As.Start(); err != nil {
+			return fmt.Errorf("error start network %s: %w", n.Name, err)
+		}
+		go m.watchNetwork(n)
+
+		if n.Gaps != nil {
+			if err := n.Gaps.Start(); err != nil {
+				return fmt.Errorf("error start gap scanner of network %s: %w", n.Name, err)
+			}
+		}
+	}
 	return nil
 }
 
+// watchNetwork reports the network whose ingestion halts.
+func (m *Manager) watchNetwork(n Network) {
+	select {
+	case <-n.As.Done():
+	case <-m.Terminate():
+		return
+	}
+
+	err := n.As.Err()
+	if err == nil {
+		return
+	}
+	m.Logger.Errorf("network %s: %s", n.Name, err.Error())
+	m.haltOnce.Do(func() {
+		m.err = fmt.Errorf("network %s: %w", n.Name, err)
+		close(m.halted)
+	})
+}
+
+// Halted is closed when the ingestion of a network halts, Err tells why.
+func (m *Manager) Halted() <-chan struct{} {
+	return m.halted
+}
+
+// Err returns the error that halted a network, if any.
+func (m *Manager) Err() error {
+	select {
+	case <-m.halted:
+		return m.err
+	default:
+		return nil
+	}
+}
+
+// OnStop drains the networks in parallel, each one within its shutdown
+// timeout.
 func (m *Manager) OnStop() error {
 	m.Logger.Info("Stop")
-	m.as.Stop()
+	var wg sync.WaitGroup
+	for _, n := range m.networks {
+		wg.Add(1)
+		go func(n Network) {
+			defer wg.Done()
+			m.stopNetwork(n)
+		}(n)
+	}
+	wg.Wait()
+
+	return nil
+}
 
-	asConfig := *m.as.ACfg
-	asConfig.StartLedgerHeight = m.as.StartLedgerSeq - PaddingLedger
+// stopNetwork stops an aggregation once its fetched ledgers are committed
+// and saves the ledger right after the last committed one, so a restart
+// resumes exactly where it stopped.
+func (m *Manager) stopNetwork(n Network) {
+	if n.Gaps != nil && n.Gaps.IsRunning() {
+		n.Gaps.Stop()
+	}
+	if n.As.IsRunning() {
+		n.As.Stop()
+	}
+
+	asConfig := *n.As.ACfg
+	if committed := n.As.LastCommittedLedger(); committed != 0 {
+		asConfig.StartLedgerHeight = committed + 1
+	}
+	asConfig.Bootstrap = false
 
 	bz, err := json.Marshal(asConfig)
 	if err != nil {
-		fmt.Println(err.Error())
+		m.Logger.Errorf("error save state of network %s: %s", n.Name, err.Error())
+		return
 	}
 
-	fmt.Println(m.cfg.AggregationConfigFile())
-	err = config.WriteState(m.cfg.AggregationConfigFile(), bz, 0o777)
+	m.Logger.Debugf("save state of network %s to %s", n.Name, n.StateFile)
+	err = config.WriteState(n.StateFile, bz, 0o777)
 	if err != nil {
-		fmt.Println(err.Error())
+		m.Logger.Errorf("error save state of network %s: %s", n.Name, err.Error())
 	}
-
-	time.Sleep(time.Second)
-	return nil
 }
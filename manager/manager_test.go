@@ -1 +1,40 @@
 package manager_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/decentrio/soro-book/config"
+	"github.com/decentrio/soro-book/manager"
+)
+
+func TestResolveNetworkErrors(t *testing.T) {
+	single := &config.ManagerConfig{
+		AggregationCfg: &config.AggregationConfig{Network: "pubnet"},
+	}
+	multi := &config.ManagerConfig{
+		Networks: []config.NetworkConfig{
+			{Name: "pubnet", Schema: "pubnet"},
+			{Name: "testnet", Schema: "testnet"},
+			{Name: "testnet", Schema: "testnet2"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		cfg     *config.ManagerConfig
+		network string
+		err     string
+	}{
+		{"other network", single, "testnet", "network testnet is not configured, the configured network is pubnet"},
+		{"unknown network", multi, "futurenet", "network futurenet is not configured"},
+		{"no network named", multi, "", "3 networks are configured, name one of them"},
+		{"ambiguous network", multi, "testnet", "network testnet is ambiguous, it is configured 2 times"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := manager.ResolveNetwork(tc.cfg, tc.network)
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
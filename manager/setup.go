@@ -1,11 +1,73 @@
 package manager
 
 import (
+	"fmt"
+
 	"github.com/decentrio/soro-book/aggregation"
 	"github.com/decentrio/soro-book/config"
+	db "github.com/decentrio/soro-book/database/handlers"
 )
 
 func DefaultNewManager(cfg *config.ManagerConfig) *Manager {
-	as := aggregation.NewAggregation(cfg.AggregationCfg)
-	return NewManager(cfg, as)
+	if len(cfg.Networks) == 0 {
+		h := db.NewDBHandler()
+		return NewManager(cfg, []Network{{
+			As:        aggregation.NewAggregation(cfg.AggregationCfg, aggregation.WithDBHandler(h)),
+			Gaps:      newGapScanner(cfg.AggregationCfg, h),
+			StateFile: cfg.AggregationConfigFile(),
+		}})
+	}
+
+	networks := make([]Network, len(cfg.Networks))
+	for i := range cfg.Networks {
+		n := &cfg.Networks[i]
+		h := db.NewDBHandlerWithSchema(n.PostgresURL, n.Schema)
+		networks[i] = Network{
+			Name:      n.Name,
+			As:        aggregation.NewAggregation(&n.Aggregation, aggregation.WithDBHandler(h)),
+			Gaps:      newGapScanner(&n.Aggregation, h),
+			StateFile: cfg.NetworkAggregationConfigFile(n.Name),
+		}
+	}
+
+	return NewManager(cfg, networks)
+}
+
+// newGapScanner returns the gap scanner of a network, nil when disabled.
+func newGapScanner(cfg *config.AggregationConfig, h *db.DBHandler) *GapScanner {
+	if cfg.GapScanInterval == 0 {
+		return nil
+	}
+
+	return NewGapScanner(cfg, h)
+}
+
+// ResolveNetwork returns the aggregation config and the database handler of
+// the network name, for the commands that work on the data of one network.
+// An empty name is the only configured network.
+func ResolveNetwork(cfg *config.ManagerConfig, name string) (*config.AggregationConfig, *db.DBHandler, error) {
+	if len(cfg.Networks) == 0 {
+		if name != "" && name != cfg.AggregationCfg.Network {
+			return nil, nil, fmt.Errorf("network %s is not configured, the configured network is %s", name, cfg.AggregationCfg.Network)
+		}
+		return cfg.AggregationCfg, db.NewDBHandler(), nil
+	}
+
+	var found []*config.NetworkConfig
+	for i := range cfg.Networks {
+		if name == "" || cfg.Networks[i].Name == name {
+			found = append(found, &cfg.Networks[i])
+		}
+	}
+	switch {
+	case len(found) == 0:
+		return nil, nil, fmt.Errorf("network %s is not configured", name)
+	case len(found) > 1 && name == "":
+		return nil, nil, fmt.Errorf("%d networks are configured, name one of them", len(found))
+	case len(found) > 1:
+		return nil, nil, fmt.Errorf("network %s is ambiguous, it is configured %d times", name, len(found))
+	}
+
+	n := found[0]
+	return &n.Aggregation, db.NewDBHandlerWithSchema(n.PostgresURL, n.Schema), nil
 }